@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log"
+	"os"
 	"os/signal"
 	"syscall"
 
@@ -12,26 +13,33 @@ import (
 )
 
 func main() {
-	cfg, err := config.LoadRuntime()
+	conf, err := config.Load()
 	if err != nil {
-		log.Fatalf("load runtime: %v", err)
+		log.Fatalf("load config:\n%v", err)
 	}
-	repos, err := config.LoadRepos(cfg.ReposFile)
-	if err != nil {
-		log.Fatalf("load repos: %v", err)
-	}
-	allow, err := config.LoadAllowList(cfg.AllowListFile)
-	if err != nil {
-		log.Fatalf("load allowlist: %v", err)
-	}
-	app, err := orchestrator.New(cfg, repos, allow)
+	cfg := conf.Runtime
+	app, err := orchestrator.New(cfg, conf.Repos, conf.Access)
 	if err != nil {
 		log.Fatalf("create app: %v", err)
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
-	log.Printf("runner started, poll interval=%s", cfg.PollInterval)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			_, _ = app.Reload(ctx, "SIGHUP")
+		}
+	}()
+	switch cfg.EventMode {
+	case config.EventModeLongConn:
+		log.Printf("runner started, event mode=long connection")
+	case config.EventModeWebhook:
+		log.Printf("runner started, webhook listening on %s%s", cfg.WebhookAddr, cfg.WebhookPath)
+	default:
+		log.Printf("runner started, poll interval=%s", cfg.PollInterval)
+	}
 	if err := app.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
 		log.Fatalf("runner stopped: %v", err)
 	}
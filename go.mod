@@ -1,3 +1,8 @@
 module feishu-codex-runner
 
 go 1.22
+
+require (
+	github.com/gorilla/websocket v1.5.3
+	gopkg.in/yaml.v3 v3.0.1
+)
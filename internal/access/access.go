@@ -0,0 +1,176 @@
+// Package access decides what a Feishu user may do with the runner, from the
+// role grants in the configuration.
+package access
+
+import (
+	"fmt"
+
+	"feishu-codex-runner/internal/config"
+)
+
+// Subject is who is asking: the sender, the chat the request came from and
+// the sender's departments.
+type Subject struct {
+	OpenID      string
+	ChatID      string
+	Departments []string
+}
+
+// Policy evaluates runner-wide and per-repo grants.
+type Policy struct {
+	global []config.Grant
+	repos  map[string][]config.Grant
+	perms  map[string]map[string]bool // role -> permission set
+}
+
+func NewPolicy(acc config.Access, repos []config.RepoConfig) *Policy {
+	p := &Policy{
+		global: acc.Grants,
+		repos:  make(map[string][]config.Grant, len(repos)),
+		perms:  map[string]map[string]bool{},
+	}
+	for _, rc := range repos {
+		p.repos[rc.Name] = rc.Access
+	}
+	for _, role := range config.Roles {
+		perms, ok := acc.RolePermissions[role]
+		if !ok {
+			perms = config.DefaultRolePermissions[role]
+		}
+		p.perms[role] = map[string]bool{}
+		for _, perm := range perms {
+			p.perms[role][perm] = true
+		}
+	}
+	return p
+}
+
+// Known reports whether s holds any role, runner-wide or on some repo.
+func (p *Policy) Known(s Subject) bool {
+	if len(p.roles(s, p.global)) > 0 {
+		return true
+	}
+	for _, grants := range p.repos {
+		if len(p.roles(s, grants)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Role is the most privileged role s holds on repo, "" for none.
+func (p *Policy) Role(s Subject, repo string) string {
+	best, rank := "", -1
+	for _, role := range p.rolesOn(s, repo) {
+		if r := rankOf(role); r > rank {
+			best, rank = role, r
+		}
+	}
+	return best
+}
+
+// Check returns a *DeniedError unless one of the roles s holds on repo
+// carries perm.
+func (p *Policy) Check(s Subject, repo, perm string) error {
+	for _, role := range p.rolesOn(s, repo) {
+		if p.perms[role][perm] {
+			return nil
+		}
+	}
+	return &DeniedError{Repo: repo, Permission: perm, Role: p.Role(s, repo)}
+}
+
+// NeedsDepartments reports whether any grant names departments, i.e. whether
+// subjects' departments must be looked up.
+func (p *Policy) NeedsDepartments() bool {
+	if hasDepartments(p.global) {
+		return true
+	}
+	for _, grants := range p.repos {
+		if hasDepartments(grants) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) rolesOn(s Subject, repo string) []string {
+	return append(p.roles(s, p.global), p.roles(s, p.repos[repo])...)
+}
+
+func (p *Policy) roles(s Subject, grants []config.Grant) []string {
+	var roles []string
+	for _, g := range grants {
+		if contains(g.Users, s.OpenID) || contains(g.Chats, s.ChatID) || overlaps(g.Departments, s.Departments) {
+			roles = append(roles, g.Role)
+		}
+	}
+	return roles
+}
+
+// DeniedError explains which permission is missing.
+type DeniedError struct {
+	Repo       string
+	Permission string
+	Role       string // "" when the user has no role on the repo
+}
+
+var permissionLabels = map[string]string{
+	config.PermView:         "查看任务状态与 diff",
+	config.PermRun:          "提交或重试任务",
+	config.PermPush:         "推送任务分支",
+	config.PermPR:           "创建 PR/MR",
+	config.PermCancelOthers: "取消他人的任务",
+	config.PermConfig:       "管理 runner 配置",
+}
+
+func (e *DeniedError) Error() string {
+	role := "无角色"
+	if e.Role != "" {
+		role = e.Role
+	}
+	where := "在仓库 " + e.Repo + " 上"
+	if e.Repo == "" {
+		where = ""
+	}
+	return fmt.Sprintf("权限不足：无法%s%s（缺少 %s 权限，当前角色：%s）", where, permissionLabels[e.Permission], e.Permission, role)
+}
+
+func rankOf(role string) int {
+	for i, r := range config.Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasDepartments(grants []config.Grant) bool {
+	for _, g := range grants {
+		if len(g.Departments) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(a, b []string) bool {
+	for _, v := range b {
+		if contains(a, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package access
+
+import (
+	"errors"
+	"testing"
+
+	"feishu-codex-runner/internal/config"
+)
+
+func testPolicy() *Policy {
+	acc := config.Access{Grants: []config.Grant{
+		{Role: config.RoleRunner, Users: []string{"ou_dev"}},
+		{Role: config.RoleViewer, Chats: []string{"oc_team"}},
+		{Role: config.RoleAdmin, Users: []string{"ou_lead"}},
+	}}
+	repos := []config.RepoConfig{
+		{Name: "aoi", Access: []config.Grant{{Role: config.RoleRunner, Departments: []string{"od_backend"}}}},
+		{Name: "web"},
+	}
+	return NewPolicy(acc, repos)
+}
+
+func TestPolicyRoles(t *testing.T) {
+	p := testPolicy()
+	cases := []struct {
+		s    Subject
+		repo string
+		perm string
+		ok   bool
+	}{
+		{Subject{OpenID: "ou_dev"}, "web", config.PermRun, true},
+		{Subject{OpenID: "ou_dev"}, "web", config.PermCancelOthers, false},
+		{Subject{OpenID: "ou_x", ChatID: "oc_team"}, "web", config.PermView, true},
+		{Subject{OpenID: "ou_x", ChatID: "oc_team"}, "web", config.PermRun, false},
+		{Subject{OpenID: "ou_x", Departments: []string{"od_backend"}}, "aoi", config.PermPush, true},
+		{Subject{OpenID: "ou_x", Departments: []string{"od_backend"}}, "web", config.PermView, false},
+		{Subject{OpenID: "ou_lead"}, "", config.PermConfig, true},
+	}
+	for _, c := range cases {
+		if err := p.Check(c.s, c.repo, c.perm); (err == nil) != c.ok {
+			t.Errorf("Check(%+v, %s, %s) = %v, want allowed=%v", c.s, c.repo, c.perm, err, c.ok)
+		}
+	}
+	if !p.Known(Subject{Departments: []string{"od_backend"}}) || p.Known(Subject{OpenID: "ou_stranger"}) {
+		t.Fatal("Known should cover repo grants and nothing else")
+	}
+	if got := p.Role(Subject{OpenID: "ou_dev", ChatID: "oc_team"}, "web"); got != config.RoleRunner {
+		t.Fatalf("highest role = %q, want runner", got)
+	}
+	if !p.NeedsDepartments() {
+		t.Fatal("department grant should require department lookups")
+	}
+}
+
+func TestPolicyRoleOverridesAndDenial(t *testing.T) {
+	acc := config.Access{
+		Grants:          []config.Grant{{Role: config.RoleRunner, Users: []string{"ou_dev"}}},
+		RolePermissions: map[string][]string{config.RoleRunner: {config.PermView, config.PermRun}},
+	}
+	p := NewPolicy(acc, []config.RepoConfig{{Name: "aoi"}})
+	err := p.Check(Subject{OpenID: "ou_dev"}, "aoi", config.PermPush)
+	var denied *DeniedError
+	if !errors.As(err, &denied) || denied.Role != config.RoleRunner {
+		t.Fatalf("want denial for runner, got %v", err)
+	}
+	if want := "权限不足：无法在仓库 aoi 上推送任务分支（缺少 push 权限，当前角色：runner）"; err.Error() != want {
+		t.Fatalf("message = %q, want %q", err.Error(), want)
+	}
+	if err := p.Check(Subject{OpenID: "ou_other"}, "aoi", config.PermView); err == nil || err.Error() != "权限不足：无法在仓库 aoi 上查看任务状态与 diff（缺少 view 权限，当前角色：无角色）" {
+		t.Fatalf("unexpected denial for stranger: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package codehost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PullRequest describes a pull/merge request to open from Head into Base.
+type PullRequest struct {
+	Title string
+	Body  string
+	Head  string
+	Base  string
+}
+
+// Provider opens pull/merge requests on a code host and returns their web URL.
+type Provider interface {
+	CreatePullRequest(ctx context.Context, pr PullRequest) (string, error)
+}
+
+// New returns the provider for kind ("github" or "gitlab"). apiURL may be
+// empty to use the public host; project is "owner/name" on GitHub and the
+// project path or numeric ID on GitLab.
+func New(kind, apiURL, project, token string) (Provider, error) {
+	if project == "" {
+		return nil, fmt.Errorf("%s provider requires a project", kind)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("%s provider requires a token", kind)
+	}
+	hc := &http.Client{Timeout: 30 * time.Second}
+	switch strings.ToLower(kind) {
+	case "github":
+		if apiURL == "" {
+			apiURL = "https://api.github.com"
+		}
+		return &GitHub{apiURL: strings.TrimRight(apiURL, "/"), repo: project, token: token, http: hc}, nil
+	case "gitlab":
+		if apiURL == "" {
+			apiURL = "https://gitlab.com"
+		}
+		return &GitLab{apiURL: strings.TrimRight(apiURL, "/"), project: project, token: token, http: hc}, nil
+	}
+	return nil, fmt.Errorf("unknown code host %q", kind)
+}
+
+// postJSON sends payload and decodes a successful response into out.
+func postJSON(ctx context.Context, hc *http.Client, url string, headers map[string]string, payload, out any) error {
+	data, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("status=%d body=%s", res.StatusCode, string(body))
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,85 @@
+package codehost
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGitHubCreatePullRequest(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/repos/acme/aoi/pulls" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer gh-token" {
+			t.Errorf("missing auth header")
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"number":7,"html_url":"https://github.com/acme/aoi/pull/7"}`))
+	}))
+	defer srv.Close()
+
+	p, err := New("github", srv.URL, "acme/aoi", "gh-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := p.CreatePullRequest(context.Background(), PullRequest{Title: "codex: fix", Body: "summary", Head: "codex/t1", Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "https://github.com/acme/aoi/pull/7" {
+		t.Fatalf("unexpected url %s", u)
+	}
+	if got["head"] != "codex/t1" || got["base"] != "main" || got["title"] != "codex: fix" || got["body"] != "summary" {
+		t.Fatalf("unexpected payload: %v", got)
+	}
+}
+
+func TestGitLabCreateMergeRequest(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.RequestURI != "/api/v4/projects/group%2Faoi/merge_requests" {
+			t.Errorf("unexpected request uri %s", r.RequestURI)
+		}
+		if r.Header.Get("PRIVATE-TOKEN") != "gl-token" {
+			t.Errorf("missing token header")
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"iid":3,"web_url":"https://gitlab.example.com/group/aoi/-/merge_requests/3"}`))
+	}))
+	defer srv.Close()
+
+	p, err := New("gitlab", srv.URL, "group/aoi", "gl-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := p.CreatePullRequest(context.Background(), PullRequest{Title: "codex: fix", Body: "summary", Head: "codex/t1", Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "https://gitlab.example.com/group/aoi/-/merge_requests/3" {
+		t.Fatalf("unexpected url %s", u)
+	}
+	if got["source_branch"] != "codex/t1" || got["target_branch"] != "main" || got["description"] != "summary" {
+		t.Fatalf("unexpected payload: %v", got)
+	}
+}
+
+func TestCreatePullRequestError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Validation Failed"}`, http.StatusUnprocessableEntity)
+	}))
+	defer srv.Close()
+	p, _ := New("github", srv.URL, "acme/aoi", "gh-token")
+	if _, err := p.CreatePullRequest(context.Background(), PullRequest{Head: "codex/t1", Base: "main"}); err == nil {
+		t.Fatal("expected error for 422 response")
+	}
+	if _, err := New("bitbucket", "", "acme/aoi", "x"); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
@@ -0,0 +1,31 @@
+package codehost
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// GitHub opens pull requests through the GitHub REST API.
+type GitHub struct {
+	apiURL string
+	repo   string
+	token  string
+	http   *http.Client
+}
+
+func (g *GitHub) CreatePullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	payload := map[string]string{"title": pr.Title, "body": pr.Body, "head": pr.Head, "base": pr.Base}
+	headers := map[string]string{
+		"Authorization":        "Bearer " + g.token,
+		"Accept":               "application/vnd.github+json",
+		"X-GitHub-Api-Version": "2022-11-28",
+	}
+	var out struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := postJSON(ctx, g.http, fmt.Sprintf("%s/repos/%s/pulls", g.apiURL, g.repo), headers, payload, &out); err != nil {
+		return "", fmt.Errorf("create github pull request: %w", err)
+	}
+	return out.HTMLURL, nil
+}
@@ -0,0 +1,34 @@
+package codehost
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GitLab opens merge requests through the GitLab REST API (v4).
+type GitLab struct {
+	apiURL  string
+	project string
+	token   string
+	http    *http.Client
+}
+
+func (g *GitLab) CreatePullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	payload := map[string]any{
+		"title":                pr.Title,
+		"description":          pr.Body,
+		"source_branch":        pr.Head,
+		"target_branch":        pr.Base,
+		"remove_source_branch": true,
+	}
+	var out struct {
+		WebURL string `json:"web_url"`
+	}
+	endpoint := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests", g.apiURL, url.PathEscape(g.project))
+	if err := postJSON(ctx, g.http, endpoint, map[string]string{"PRIVATE-TOKEN": g.token}, payload, &out); err != nil {
+		return "", fmt.Errorf("create gitlab merge request: %w", err)
+	}
+	return out.WebURL, nil
+}
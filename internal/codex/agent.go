@@ -0,0 +1,141 @@
+package codex
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Supported coding-agent backends, selectable per repo (agent in repos.yaml)
+// or per task (#agent=).
+const (
+	AgentCodex  = "codex"
+	AgentClaude = "claude"
+	AgentAider  = "aider"
+	AgentScript = "script"
+)
+
+// Agents lists the supported backends.
+var Agents = []string{AgentCodex, AgentClaude, AgentAider, AgentScript}
+
+// Agent drives one coding-agent CLI: how it is invoked, how the prompt is
+// delivered and how its output is interpreted.
+type Agent interface {
+	Name() string
+	Bin() string
+	// Command returns the arguments for running prompt and the text to feed
+	// on stdin ("" when the prompt is passed as an argument).
+	Command(prompt string) (args []string, stdin string)
+	// Parser returns a function folding output lines into res, or nil when
+	// the output is plain text. The function returns a readable form of the
+	// line for live output ("" to hide it) and ok=false for lines it does
+	// not understand, which are shown as is.
+	Parser(res *Result) func(line string) (display string, ok bool)
+	// VersionArgs are the arguments printing the agent's version, or nil
+	// when the agent cannot report one.
+	VersionArgs() []string
+}
+
+// NewAgent returns the backend for kind. An empty bin selects the CLI's
+// usual name on PATH; extraArgs are appended to the backend's own flags.
+// json enables Codex's JSON event output.
+func NewAgent(kind, bin string, extraArgs []string, json bool) (Agent, error) {
+	base := agentBase{bin: bin, extra: extraArgs}
+	switch strings.ToLower(kind) {
+	case AgentCodex, "":
+		base.name = AgentCodex
+		return codexAgent{agentBase: base.withDefaultBin("codex"), json: json}, nil
+	case AgentClaude:
+		base.name = AgentClaude
+		return claudeAgent{base.withDefaultBin("claude")}, nil
+	case AgentAider:
+		base.name = AgentAider
+		return aiderAgent{base.withDefaultBin("aider")}, nil
+	case AgentScript:
+		if bin == "" {
+			return nil, fmt.Errorf("agent %q needs agent_bin", AgentScript)
+		}
+		base.name = AgentScript
+		return scriptAgent{base}, nil
+	}
+	return nil, fmt.Errorf("unknown agent %q (supported: %s)", kind, strings.Join(Agents, ", "))
+}
+
+// Version runs the agent's version command and returns the first line.
+func Version(ctx context.Context, a Agent) (string, error) {
+	args := a.VersionArgs()
+	if args == nil {
+		return "", nil
+	}
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(cctx, a.Bin(), args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w", a.Bin(), strings.Join(args, " "), err)
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+type agentBase struct {
+	name  string
+	bin   string
+	extra []string
+}
+
+func (b agentBase) withDefaultBin(bin string) agentBase {
+	if b.bin == "" {
+		b.bin = bin
+	}
+	return b
+}
+
+func (b agentBase) Name() string          { return b.name }
+func (b agentBase) Bin() string           { return b.bin }
+func (b agentBase) VersionArgs() []string { return []string{"--version"} }
+
+func (b agentBase) Parser(*Result) func(string) (string, bool) { return nil }
+
+// codexAgent runs `codex exec`, reading the prompt from stdin.
+type codexAgent struct {
+	agentBase
+	json bool
+}
+
+func (a codexAgent) Command(prompt string) ([]string, string) {
+	args := []string{"exec"}
+	if a.json {
+		args = append(args, "--json")
+	}
+	args = append(args, a.extra...)
+	return append(args, "-"), prompt
+}
+
+func (a codexAgent) Parser(res *Result) func(string) (string, bool) {
+	if !a.json {
+		return nil
+	}
+	return (&eventParser{res: res}).consume
+}
+
+// aiderAgent runs aider non-interactively. Aider's own commits are disabled
+// so the runner's commit policy applies.
+type aiderAgent struct{ agentBase }
+
+func (a aiderAgent) Command(prompt string) ([]string, string) {
+	args := []string{"--yes-always", "--no-auto-commits", "--no-pretty", "--no-stream"}
+	args = append(args, a.extra...)
+	return append(args, "--message", prompt), ""
+}
+
+// scriptAgent runs a custom executable with the prompt on stdin. Task
+// details are also available in RUNNER_* environment variables.
+type scriptAgent struct{ agentBase }
+
+func (a scriptAgent) Command(prompt string) ([]string, string) {
+	return append([]string(nil), a.extra...), prompt
+}
+
+func (a scriptAgent) VersionArgs() []string { return nil }
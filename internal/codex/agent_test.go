@@ -0,0 +1,127 @@
+package codex
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"feishu-codex-runner/internal/model"
+)
+
+func fakeAgent(t *testing.T) string {
+	t.Helper()
+	bin, err := filepath.Abs(filepath.Join("testdata", "fake-agent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+func TestAgentPromptDelivery(t *testing.T) {
+	bin := fakeAgent(t)
+	dir := t.TempDir()
+	r := Runner{WorkDir: filepath.Join(dir, "logs"), Timeout: 10 * time.Second}
+	task := model.Task{ID: "t1", Instruction: "fix healthz"}
+
+	cases := []struct {
+		kind string
+		want []string
+	}{
+		{AgentCodex, []string{"args: exec -", "stdin: "}},
+		{AgentAider, []string{"args: --yes-always --no-auto-commits --no-pretty --no-stream --extra --message "}},
+		{AgentScript, []string{"args: --extra\n", "task: t1", "stdin: "}},
+	}
+	for _, tc := range cases {
+		var extra []string
+		if tc.kind != AgentCodex {
+			extra = []string{"--extra"}
+		}
+		agent, err := NewAgent(tc.kind, bin, extra, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := r.Execute(context.Background(), agent, task, dir, nil)
+		if res.ExitErr != nil || res.Agent != tc.kind {
+			t.Fatalf("%s: unexpected result %+v", tc.kind, res)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(res.Output, want) {
+				t.Fatalf("%s: output missing %q:\n%s", tc.kind, want, res.Output)
+			}
+		}
+		if !strings.Contains(res.Output, "fix healthz") {
+			t.Fatalf("%s: prompt not delivered:\n%s", tc.kind, res.Output)
+		}
+	}
+}
+
+func TestClaudeAgentParsesStreamJSON(t *testing.T) {
+	fixture, _ := filepath.Abs(filepath.Join("testdata", "claude_stream.jsonl"))
+	t.Setenv("FAKE_AGENT_OUTPUT", fixture)
+	t.Setenv("FAKE_AGENT_WRITE", "health.go")
+	dir := t.TempDir()
+	agent, err := NewAgent(AgentClaude, fakeAgent(t), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := NewOutput(20)
+	res := Runner{WorkDir: filepath.Join(dir, "logs"), Timeout: 10 * time.Second}.Execute(context.Background(), agent, model.Task{ID: "t2"}, dir, out)
+	if res.ExitErr != nil {
+		t.Fatal(res.ExitErr)
+	}
+	if !strings.Contains(res.Output, "--permission-mode acceptEdits") {
+		t.Fatalf("claude should default to acceptEdits:\n%s", res.Output)
+	}
+	if res.FinalMessage != "healthz returns 503 when Redis is down." {
+		t.Fatalf("final message %q", res.FinalMessage)
+	}
+	if len(res.Commands) != 1 || res.Commands[0].ExitCode != 1 {
+		t.Fatalf("unexpected commands %+v", res.Commands)
+	}
+	if len(res.FilesChanged) != 1 || res.FilesChanged[0].Path != "internal/http/health.go" {
+		t.Fatalf("unexpected file changes %+v", res.FilesChanged)
+	}
+	if res.Usage != (Usage{InputTokens: 1200, CachedInputTokens: 800, OutputTokens: 95}) {
+		t.Fatalf("unexpected usage %+v", res.Usage)
+	}
+	if tail := strings.Join(out.Tail(0), "\n"); !strings.Contains(tail, "$ go test ./internal/http/") || strings.Contains(tail, `"type"`) {
+		t.Fatalf("unexpected live output:\n%s", tail)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "health.go")); err != nil {
+		t.Fatalf("agent should run in the repo dir: %v", err)
+	}
+}
+
+func TestNewAgentAndVersion(t *testing.T) {
+	if _, err := NewAgent("copilot", "", nil, false); err == nil {
+		t.Fatal("expected error for unknown agent")
+	}
+	if _, err := NewAgent(AgentScript, "", nil, false); err == nil {
+		t.Fatal("script agent without agent_bin should be rejected")
+	}
+	a, _ := NewAgent(AgentClaude, "", nil, false)
+	if a.Bin() != "claude" {
+		t.Fatalf("default bin %q", a.Bin())
+	}
+	a, _ = NewAgent(AgentAider, fakeAgent(t), nil, false)
+	ver, err := Version(context.Background(), a)
+	if err != nil || ver != "fake-agent 1.2.3" {
+		t.Fatalf("version %q err=%v", ver, err)
+	}
+}
+
+func TestRunTestsKeepsNonGoOutput(t *testing.T) {
+	dir := t.TempDir()
+	r := Runner{WorkDir: dir, Timeout: 10 * time.Second}
+	task := model.Task{ID: "t3", TestCmd: `printf '1..2\nok 1 - renders header\nnot ok 2 - renders footer\n'; exit 1`}
+	out, tests, err := r.RunTests(context.Background(), task, dir)
+	if err == nil || tests != nil {
+		t.Fatalf("TAP output must not be parsed as go test: tests=%+v err=%v", tests, err)
+	}
+	if !strings.Contains(out, "not ok 2 - renders footer") {
+		t.Fatalf("raw output lost: %q", out)
+	}
+}
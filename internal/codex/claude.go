@@ -0,0 +1,128 @@
+package codex
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// claudeAgent runs Claude Code in print mode with streaming JSON output.
+// Unless agent_args choose another permission mode it may edit files but not
+// run arbitrary commands; e.g. "--allowedTools Bash" widens that.
+type claudeAgent struct{ agentBase }
+
+func (a claudeAgent) Command(prompt string) ([]string, string) {
+	args := []string{"-p", "--output-format", "stream-json", "--verbose"}
+	if !hasArg(a.extra, "--permission-mode", "--dangerously-skip-permissions") {
+		args = append(args, "--permission-mode", "acceptEdits")
+	}
+	return append(args, a.extra...), prompt
+}
+
+func hasArg(args []string, names ...string) bool {
+	for _, a := range args {
+		for _, n := range names {
+			if a == n || strings.HasPrefix(a, n+"=") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a claudeAgent) Parser(res *Result) func(string) (string, bool) {
+	return (&claudeParser{res: res, commands: map[string]int{}}).consume
+}
+
+type claudeEvent struct {
+	Type    string `json:"type"`
+	Message *struct {
+		Content []claudeContent `json:"content"`
+	} `json:"message"`
+	Result  string `json:"result"`
+	IsError bool   `json:"is_error"`
+	Usage   *struct {
+		InputTokens          int `json:"input_tokens"`
+		CacheReadInputTokens int `json:"cache_read_input_tokens"`
+		OutputTokens         int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+type claudeContent struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Input struct {
+		Command  string `json:"command"`
+		FilePath string `json:"file_path"`
+	} `json:"input"`
+	ToolUseID string `json:"tool_use_id"`
+	IsError   bool   `json:"is_error"`
+}
+
+// claudeParser folds Claude Code's stream-json events into a Result. Bash
+// tool calls become Commands; their exit code is 1 when the tool result is
+// an error and 0 otherwise, as the exact code is not reported.
+type claudeParser struct {
+	res      *Result
+	commands map[string]int // tool_use id -> index in res.Commands
+}
+
+func (p *claudeParser) consume(line string) (string, bool) {
+	var ev claudeEvent
+	if !strings.HasPrefix(strings.TrimSpace(line), "{") || json.Unmarshal([]byte(line), &ev) != nil || ev.Type == "" {
+		return "", false
+	}
+	switch ev.Type {
+	case "assistant", "user":
+		if ev.Message == nil {
+			return "", true
+		}
+		var shown []string
+		for _, c := range ev.Message.Content {
+			if s := p.content(c); s != "" {
+				shown = append(shown, s)
+			}
+		}
+		return strings.Join(shown, "\n"), true
+	case "result":
+		if ev.Result != "" {
+			p.res.FinalMessage = ev.Result
+		}
+		if ev.IsError {
+			p.res.AgentErrors = append(p.res.AgentErrors, ev.Result)
+		}
+		if ev.Usage != nil {
+			p.res.Usage.InputTokens += ev.Usage.InputTokens
+			p.res.Usage.CachedInputTokens += ev.Usage.CacheReadInputTokens
+			p.res.Usage.OutputTokens += ev.Usage.OutputTokens
+		}
+	}
+	return "", true
+}
+
+func (p *claudeParser) content(c claudeContent) string {
+	switch c.Type {
+	case "text":
+		p.res.AgentMessages = append(p.res.AgentMessages, c.Text)
+		return c.Text
+	case "tool_use":
+		switch c.Name {
+		case "Bash":
+			p.commands[c.ID] = len(p.res.Commands)
+			p.res.Commands = append(p.res.Commands, CommandRun{Command: c.Input.Command})
+			return "$ " + c.Input.Command
+		case "Write":
+			p.res.FilesChanged = appendChange(p.res.FilesChanged, FileChange{Path: c.Input.FilePath, Kind: "write"})
+			return "✎ write " + c.Input.FilePath
+		case "Edit", "MultiEdit":
+			p.res.FilesChanged = appendChange(p.res.FilesChanged, FileChange{Path: c.Input.FilePath, Kind: "update"})
+			return "✎ update " + c.Input.FilePath
+		}
+	case "tool_result":
+		if i, ok := p.commands[c.ToolUseID]; ok && c.IsError {
+			p.res.Commands[i].ExitCode = 1
+		}
+	}
+	return ""
+}
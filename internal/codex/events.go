@@ -0,0 +1,125 @@
+package codex
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CommandRun is a shell command Codex executed during a task.
+type CommandRun struct {
+	Command  string `json:"command"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// FileChange is a file Codex added, updated or deleted.
+type FileChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+}
+
+// Usage is the token usage reported when a Codex turn completes.
+type Usage struct {
+	InputTokens       int `json:"input_tokens"`
+	CachedInputTokens int `json:"cached_input_tokens"`
+	OutputTokens      int `json:"output_tokens"`
+}
+
+// execEvent is one line of `codex exec --json` output.
+type execEvent struct {
+	Type    string    `json:"type"`
+	Item    *execItem `json:"item"`
+	Usage   *Usage    `json:"usage"`
+	Message string    `json:"message"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type execItem struct {
+	Type     string       `json:"type"`
+	Text     string       `json:"text"`
+	Command  string       `json:"command"`
+	ExitCode *int         `json:"exit_code"`
+	Changes  []FileChange `json:"changes"`
+	Message  string       `json:"message"`
+}
+
+// eventParser folds the JSON event stream into a Result.
+type eventParser struct {
+	res *Result
+}
+
+// consume records one output line. It returns a human readable form of the
+// event for live output, "" for events not worth showing, and ok=false when
+// the line is not a JSON event (e.g. stderr noise), which callers show as is.
+func (p *eventParser) consume(line string) (display string, ok bool) {
+	var ev execEvent
+	if !strings.HasPrefix(strings.TrimSpace(line), "{") || json.Unmarshal([]byte(line), &ev) != nil || ev.Type == "" {
+		return "", false
+	}
+	switch ev.Type {
+	case "item.started":
+		if ev.Item != nil && ev.Item.Type == "command_execution" {
+			return "$ " + ev.Item.Command, true
+		}
+	case "item.completed":
+		return p.item(ev.Item), true
+	case "turn.completed":
+		if ev.Usage != nil {
+			p.res.Usage.InputTokens += ev.Usage.InputTokens
+			p.res.Usage.CachedInputTokens += ev.Usage.CachedInputTokens
+			p.res.Usage.OutputTokens += ev.Usage.OutputTokens
+		}
+	case "turn.failed":
+		if ev.Error != nil {
+			p.res.AgentErrors = append(p.res.AgentErrors, ev.Error.Message)
+			return "✗ " + ev.Error.Message, true
+		}
+	case "error":
+		p.res.AgentErrors = append(p.res.AgentErrors, ev.Message)
+		return "✗ " + ev.Message, true
+	}
+	return "", true
+}
+
+func (p *eventParser) item(it *execItem) string {
+	if it == nil {
+		return ""
+	}
+	switch it.Type {
+	case "agent_message":
+		p.res.AgentMessages = append(p.res.AgentMessages, it.Text)
+		p.res.FinalMessage = it.Text
+		return it.Text
+	case "command_execution":
+		run := CommandRun{Command: it.Command, ExitCode: -1}
+		if it.ExitCode != nil {
+			run.ExitCode = *it.ExitCode
+		}
+		p.res.Commands = append(p.res.Commands, run)
+		return fmt.Sprintf("$ %s (exit %d)", run.Command, run.ExitCode)
+	case "file_change":
+		var paths []string
+		for _, c := range it.Changes {
+			p.res.FilesChanged = appendChange(p.res.FilesChanged, c)
+			paths = append(paths, c.Kind+" "+c.Path)
+		}
+		return "✎ " + strings.Join(paths, ", ")
+	case "error":
+		p.res.AgentErrors = append(p.res.AgentErrors, it.Message)
+		return "✗ " + it.Message
+	}
+	return ""
+}
+
+// appendChange adds c, replacing an earlier change to the same path.
+func appendChange(changes []FileChange, c FileChange) []FileChange {
+	for i := range changes {
+		if changes[i].Path == c.Path {
+			changes[i].Kind = c.Kind
+			return changes
+		}
+	}
+	return append(changes, c)
+}
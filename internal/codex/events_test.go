@@ -0,0 +1,49 @@
+package codex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEventParserBuildsStructuredResult(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "exec_events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res Result
+	p := &eventParser{res: &res}
+	var shown []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		display, ok := p.consume(line)
+		if !ok {
+			display = line
+		}
+		if display != "" {
+			shown = append(shown, display)
+		}
+	}
+
+	if res.FinalMessage != "healthz now returns 503 when Redis is unavailable; tests pass." || len(res.AgentMessages) != 2 {
+		t.Fatalf("unexpected messages: final=%q all=%v", res.FinalMessage, res.AgentMessages)
+	}
+	if len(res.Commands) != 2 || res.Commands[0].ExitCode != 0 || res.Commands[1].ExitCode != 1 || res.Commands[1].Command != "bash -lc 'go test ./...'" {
+		t.Fatalf("unexpected commands: %+v", res.Commands)
+	}
+	if len(res.FilesChanged) != 2 || res.FilesChanged[1] != (FileChange{Path: "internal/http/health_test.go", Kind: "add"}) {
+		t.Fatalf("unexpected file changes: %+v", res.FilesChanged)
+	}
+	if res.Usage != (Usage{InputTokens: 24763, CachedInputTokens: 24448, OutputTokens: 122}) {
+		t.Fatalf("unexpected usage: %+v", res.Usage)
+	}
+	joined := strings.Join(shown, "\n")
+	for _, want := range []string{"$ bash -lc 'rg -n healthz'", "(exit 1)", "warning: stderr noise is kept as plain text", "✎ update internal/http/health.go, add internal/http/health_test.go"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("live output missing %q:\n%s", want, joined)
+		}
+	}
+	if strings.Contains(joined, `"type"`) {
+		t.Fatalf("raw JSON leaked into live output:\n%s", joined)
+	}
+}
@@ -0,0 +1,156 @@
+package codex
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxLineBytes caps a single buffered line; longer lines are split.
+const maxLineBytes = 16 << 10
+
+// Output collects a running process's output line by line. It keeps the most
+// recent lines in a ring buffer and fans new lines out to subscribers, so the
+// latest output can be shown while the task is still running.
+type Output struct {
+	mu     sync.Mutex
+	lines  []string
+	next   int
+	full   bool
+	subs   map[chan string]struct{}
+	closed bool
+}
+
+// NewOutput returns an Output that remembers the last capacity lines.
+func NewOutput(capacity int) *Output {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Output{lines: make([]string, capacity), subs: map[chan string]struct{}{}}
+}
+
+func (o *Output) add(line string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	o.lines[o.next] = line
+	o.next = (o.next + 1) % len(o.lines)
+	if o.next == 0 {
+		o.full = true
+	}
+	for ch := range o.subs {
+		// Slow subscribers miss lines rather than stall the process.
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// Tail returns up to n of the most recent lines, oldest first. n <= 0
+// returns everything buffered.
+func (o *Output) Tail(n int) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var out []string
+	if o.full {
+		out = append(out, o.lines[o.next:]...)
+	}
+	out = append(out, o.lines[:o.next]...)
+	if n > 0 && len(out) > n {
+		out = out[len(out)-n:]
+	}
+	return out
+}
+
+// Subscribe returns a channel receiving lines written from now on, and a
+// function to stop the subscription. The channel is closed when the output
+// is closed or the subscription is cancelled.
+func (o *Output) Subscribe(buffer int) (<-chan string, func()) {
+	ch := make(chan string, buffer)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	o.subs[ch] = struct{}{}
+	return ch, func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if _, ok := o.subs[ch]; ok {
+			delete(o.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends all subscriptions once the process has exited.
+func (o *Output) Close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	o.closed = true
+	for ch := range o.subs {
+		delete(o.subs, ch)
+		close(ch)
+	}
+}
+
+// streamWriter receives a process's stdout and stderr. Bytes go straight to
+// the log file so nothing is lost if the runner dies, the first max bytes are
+// kept for the result, and complete lines are passed to onLine.
+type streamWriter struct {
+	log     io.Writer
+	logErr  error
+	onLine  func(line string)
+	max     int
+	head    []byte
+	partial []byte
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	// A failing log write must not kill the process; later writes are
+	// skipped and the error is reported once it exits.
+	if w.log != nil && w.logErr == nil {
+		_, w.logErr = w.log.Write(p)
+	}
+	// One byte past max is kept so trim can tell the output was cut.
+	keep := p
+	if w.max > 0 {
+		keep = p[:min(len(p), max(0, w.max+1-len(w.head)))]
+	}
+	w.head = append(w.head, keep...)
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+	for len(w.partial) > maxLineBytes {
+		w.emit(w.partial[:maxLineBytes])
+		w.partial = w.partial[maxLineBytes:]
+	}
+	return len(p), nil
+}
+
+// flush emits a trailing line that had no newline.
+func (w *streamWriter) flush() {
+	if len(w.partial) > 0 {
+		w.emit(w.partial)
+		w.partial = nil
+	}
+}
+
+func (w *streamWriter) emit(line []byte) {
+	if w.onLine != nil {
+		w.onLine(string(bytes.TrimRight(line, "\r")))
+	}
+}
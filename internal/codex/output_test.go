@@ -0,0 +1,77 @@
+package codex
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"feishu-codex-runner/internal/model"
+)
+
+func TestOutputRingAndSubscribe(t *testing.T) {
+	out := NewOutput(3)
+	lines, unsubscribe := out.Subscribe(10)
+	w := &streamWriter{onLine: out.add, max: 8}
+	_, _ = w.Write([]byte("one\ntwo\nthr"))
+	_, _ = w.Write([]byte("ee\r\nfour\nfive"))
+	w.flush()
+
+	if got := strings.Join(out.Tail(0), ","); got != "three,four,five" {
+		t.Fatalf("ring holds %q", got)
+	}
+	if got := strings.Join(out.Tail(2), ","); got != "four,five" {
+		t.Fatalf("tail(2) = %q", got)
+	}
+	if string(w.head) != "one\ntwo\nt" {
+		t.Fatalf("head keeps max+1 bytes, got %q", w.head)
+	}
+	var seen []string
+	for i := 0; i < 5; i++ {
+		seen = append(seen, <-lines)
+	}
+	if strings.Join(seen, ",") != "one,two,three,four,five" {
+		t.Fatalf("subscriber saw %v", seen)
+	}
+	unsubscribe()
+	if _, ok := <-lines; ok {
+		t.Fatal("channel should be closed after unsubscribe")
+	}
+	out.Close()
+	late, _ := out.Subscribe(1)
+	if _, ok := <-late; ok {
+		t.Fatal("subscribing to a closed output should yield a closed channel")
+	}
+}
+
+func TestExecuteStreamsToLog(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "fake-codex")
+	script := "#!/bin/sh\necho started\necho oops >&2\nsleep 0.2\necho done\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	r := Runner{WorkDir: filepath.Join(dir, "logs"), Timeout: 10 * time.Second, MaxOutput: 1000}
+	agent, _ := NewAgent(AgentScript, bin, nil, false)
+	out := NewOutput(10)
+	lines, _ := out.Subscribe(10)
+
+	done := make(chan Result)
+	go func() { done <- r.Execute(context.Background(), agent, model.Task{ID: "t1"}, dir, out) }()
+	if first := <-lines; first != "started" {
+		t.Fatalf("first streamed line %q", first)
+	}
+	// The log is written as output arrives, before Codex exits.
+	if b, _ := os.ReadFile(filepath.Join(dir, "logs", "task-t1.log")); !strings.Contains(string(b), "started") {
+		t.Fatalf("log not written incrementally: %q", b)
+	}
+	res := <-done
+	if res.ExitErr != nil || res.Output != "started\noops\ndone\n" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if b, _ := os.ReadFile(res.LogPath); !strings.HasPrefix(string(b), "==> script ") {
+		t.Fatalf("log should start with a run header: %q", b)
+	}
+}
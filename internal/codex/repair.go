@@ -0,0 +1,81 @@
+package codex
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"feishu-codex-runner/internal/model"
+)
+
+// Attempt is the outcome of one agent run plus its test run. The first
+// attempt is the original task, later ones are repairs.
+type Attempt struct {
+	Number   int
+	Duration time.Duration
+	ExitErr  error
+	TestErr  error
+	LintErr  error
+}
+
+// repairOutputLines caps the test output fed back to the agent; the end of
+// the output usually holds the failures.
+const repairOutputLines = 150
+
+// RepairTask turns task into a follow-up asking the agent to fix the tests
+// or lint that failed in prev. Parsed go test failures are given with their
+// own log lines; other output is given as its tail.
+func RepairTask(task model.Task, attempt int, prev Result, lintCmd string) model.Task {
+	var failures []string
+	switch {
+	case prev.Tests != nil && len(prev.Tests.Failures) > 0:
+		parts := []string{"测试命令：" + task.TestCmd, "测试结果：" + prev.Tests.Summary()}
+		for _, f := range prev.Tests.Failures {
+			parts = append(parts, f.String())
+		}
+		failures = append(failures, strings.Join(parts, "\n\n"))
+	case prev.TestErr != nil:
+		failures = append(failures, fmt.Sprintf("测试命令：%s\n测试输出（末尾部分）：\n%s", task.TestCmd, tailLines(prev.TestOutput, repairOutputLines)))
+	}
+	if prev.LintErr != nil {
+		failures = append(failures, fmt.Sprintf("Lint 命令：%s\nLint 输出（末尾部分）：\n%s", lintCmd, tailLines(prev.LintOutput, repairOutputLines)))
+	}
+	task.Mode = "repair"
+	task.Instruction = fmt.Sprintf(`上一轮修改后检查未通过（第 %d 次修复）。
+原始任务：%s
+
+%s
+
+请在现有改动的基础上修复，使测试与检查通过。不要删除、跳过或弱化测试。`,
+		attempt, task.Instruction, strings.Join(failures, "\n\n"))
+	return task
+}
+
+// Continue folds a repair run into r: next becomes the current outcome while
+// time, token usage, commands, file changes and agent messages accumulate.
+func (r Result) Continue(next Result) Result {
+	next.Duration += r.Duration
+	next.Usage.InputTokens += r.Usage.InputTokens
+	next.Usage.CachedInputTokens += r.Usage.CachedInputTokens
+	next.Usage.OutputTokens += r.Usage.OutputTokens
+	next.Commands = append(r.Commands, next.Commands...)
+	next.AgentMessages = append(r.AgentMessages, next.AgentMessages...)
+	for _, c := range next.FilesChanged {
+		r.FilesChanged = appendChange(r.FilesChanged, c)
+	}
+	next.FilesChanged = r.FilesChanged
+	next.AgentVersion = r.AgentVersion
+	next.Attempts = r.Attempts
+	if next.Output == "" {
+		next.Output = r.Output
+	}
+	return next
+}
+
+func tailLines(s string, max int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) <= max {
+		return strings.Join(lines, "\n")
+	}
+	return "... (truncated)\n" + strings.Join(lines[len(lines)-max:], "\n")
+}
@@ -3,31 +3,66 @@ package codex
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"feishu-codex-runner/internal/gotest"
 	"feishu-codex-runner/internal/model"
 )
 
+// Runner executes coding agents for tasks and runs their tests. WorkDir
+// holds the per-task logs.
 type Runner struct {
-	Bin       string
 	WorkDir   string
 	Timeout   time.Duration
 	MaxOutput int
+	// Env ("KEY=value") is added to the environment of the agent and of all
+	// commands run in the worktree; Preamble is put before the prompt.
+	Env      []string
+	Preamble string
 }
 
 type Result struct {
-	Prompt     string
-	Output     string
-	LogPath    string
-	Duration   time.Duration
-	TimedOut   bool
-	ExitErr    error
-	TestOutput string
-	TestErr    error
+	Agent          string
+	AgentVersion   string
+	Prompt         string
+	Output         string
+	LogPath        string
+	Duration       time.Duration
+	TimedOut       bool
+	ExitErr        error
+	TestOutput     string
+	TestLogPath    string
+	TestErr        error
+	Tests          *gotest.Report // nil unless the test command is go test
+	LintOutput     string
+	LintErr        error
+	Branch         string
+	Worktree       string
+	CommitSHA      string
+	PushBranch     string
+	CommitErr      error
+	PullRequestURL string
+	PullRequestErr error
+	// Uploaded names the log and patch files sent to the chat.
+	Uploaded []string
+
+	// Filled by agents with structured output (Codex in JSON mode, Claude).
+	FinalMessage  string
+	AgentMessages []string
+	Commands      []CommandRun
+	FilesChanged  []FileChange
+	Usage         Usage
+	AgentErrors   []string
+
+	// Attempts lists each agent run and its test outcome when the repair
+	// loop re-ran the agent after failing tests.
+	Attempts []Attempt
 }
 
 var blockedKeywords = []string{"rm -rf", "git push --force", "sudo ", "mkfs", "shutdown", "reboot"}
@@ -42,10 +77,18 @@ func ValidateSafety(instruction string) error {
 	return nil
 }
 
-func (r Runner) Execute(ctx context.Context, task model.Task, repoPath string) Result {
+// Execute runs agent for task in repoPath. Output is streamed line by line
+// into the task log and, when out is non-nil, into out so callers can follow
+// it while the agent runs. For agents with
+// structured output out receives a readable rendering of each event instead
+// of the raw JSON.
+func (r Runner) Execute(ctx context.Context, agent Agent, task model.Task, repoPath string, out *Output) Result {
 	start := time.Now()
-	result := Result{}
+	result := Result{Agent: agent.Name()}
 	prompt := buildPrompt(task)
+	if r.Preamble != "" {
+		prompt = r.Preamble + "\n\n" + prompt
+	}
 	result.Prompt = prompt
 
 	if err := os.MkdirAll(r.WorkDir, 0o755); err != nil {
@@ -54,30 +97,106 @@ func (r Runner) Execute(ctx context.Context, task model.Task, repoPath string) R
 	}
 	logPath := filepath.Join(r.WorkDir, fmt.Sprintf("task-%s.log", task.ID))
 	result.LogPath = logPath
+	// Repair attempts append to the same log.
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		result.ExitErr = err
+		return result
+	}
+	defer logFile.Close()
+	fmt.Fprintf(logFile, "==> %s %s (mode=%s)\n", agent.Name(), start.Format(time.RFC3339), task.Mode)
 
 	cctx, cancel := context.WithTimeout(ctx, r.Timeout)
 	defer cancel()
-	cmd := exec.CommandContext(cctx, r.Bin, "exec", "-")
+	args, stdin := agent.Command(prompt)
+	parse := agent.Parser(&result)
+	onLine := func(line string) {
+		if parse != nil {
+			display, ok := parse(line)
+			if ok {
+				line = display
+			}
+		}
+		if out != nil && line != "" {
+			out.add(line)
+		}
+	}
+	cmd := exec.CommandContext(cctx, agent.Bin(), args...)
 	cmd.Dir = repoPath
-	cmd.Stdin = strings.NewReader(prompt)
-	out, err := cmd.CombinedOutput()
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Env = append(r.environ(),
+		"RUNNER_TASK_ID="+task.ID,
+		"RUNNER_REPO="+task.Repo,
+		"RUNNER_TEST_CMD="+task.TestCmd,
+	)
+	w := &streamWriter{log: logFile, onLine: onLine, max: r.MaxOutput}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err = cmd.Run()
+	w.flush()
+	if w.logErr != nil {
+		log.Printf("task %s: write log: %v", task.ID, w.logErr)
+	}
 	if cctx.Err() == context.DeadlineExceeded {
 		result.TimedOut = true
 	}
-	result.Output = trim(string(out), r.MaxOutput)
-	_ = os.WriteFile(logPath, out, 0o644)
+	result.Output = trim(string(w.head), r.MaxOutput)
 	result.ExitErr = err
 	result.Duration = time.Since(start)
 	return result
 }
 
-func (r Runner) RunTests(ctx context.Context, task model.Task, repoPath string) (string, error) {
+// RunTests runs the task's test command. A plain `go test` command is run
+// with -json so the full run can be summarised before the output is trimmed;
+// the returned output is then the usual non-verbose form.
+func (r Runner) RunTests(ctx context.Context, task model.Task, repoPath string) (string, *gotest.Report, error) {
+	out, err := r.shell(ctx, repoPath, gotest.WithJSON(task.TestCmd))
+	// Other test runners' output (e.g. TAP "ok 1 - ...") can look like
+	// go test's, so it is passed through as is.
+	var tests *gotest.Report
+	if gotest.IsGoTest(task.TestCmd) {
+		if tests = gotest.Parse(out); tests != nil {
+			out = tests.Output
+		}
+	}
+	r.appendTestLog(task, out)
+	return trim(out, r.MaxOutput), tests, err
+}
+
+// TestLogPath is where the complete output of a task's test runs is kept.
+func (r Runner) TestLogPath(taskID string) string {
+	return filepath.Join(r.WorkDir, fmt.Sprintf("task-%s.test.log", taskID))
+}
+
+func (r Runner) appendTestLog(task model.Task, out string) {
+	f, err := os.OpenFile(r.TestLogPath(task.ID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Printf("task %s: write test log: %v", task.ID, err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "==> %s %s\n%s\n", task.TestCmd, time.Now().Format(time.RFC3339), out)
+}
+
+// RunCommand runs a shell command such as a repo's setup or lint command in
+// the worktree and returns its trimmed combined output.
+func (r Runner) RunCommand(ctx context.Context, dir, command string) (string, error) {
+	out, err := r.shell(ctx, dir, command)
+	return trim(out, r.MaxOutput), err
+}
+
+func (r Runner) shell(ctx context.Context, dir, command string) (string, error) {
 	cctx, cancel := context.WithTimeout(ctx, 20*time.Minute)
 	defer cancel()
-	cmd := exec.CommandContext(cctx, "bash", "-lc", task.TestCmd)
-	cmd.Dir = repoPath
+	cmd := exec.CommandContext(cctx, "bash", "-lc", command)
+	cmd.Dir = dir
+	cmd.Env = r.environ()
 	out, err := cmd.CombinedOutput()
-	return trim(string(out), r.MaxOutput), err
+	return string(out), err
+}
+
+func (r Runner) environ() []string {
+	return append(os.Environ(), r.Env...)
 }
 
 func buildPrompt(task model.Task) string {
@@ -93,7 +212,31 @@ func buildPrompt(task model.Task) string {
 
 任务模式：%s
 用户任务：%s
-`, task.TestCmd, task.Mode, task.Instruction)
+`, task.TestCmd, task.Mode, task.Instruction) + attachmentSection(task.Attachments)
+}
+
+// attachmentSection lists the task's downloaded attachments and includes the
+// text read from text files.
+func attachmentSection(atts []model.Attachment) string {
+	if len(atts) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n用户附件（已下载到本地，可直接读取）：\n")
+	for _, att := range atts {
+		fmt.Fprintf(&b, "- %s（%s，%d 字节）\n", att.Path, att.Name, att.Size)
+	}
+	for _, att := range atts {
+		if att.Text == "" {
+			continue
+		}
+		note := ""
+		if int64(len(att.Text)) < att.Size {
+			note = "，仅前 " + strconv.Itoa(len(att.Text)) + " 字节，完整内容见文件"
+		}
+		fmt.Fprintf(&b, "\n附件 %s 的内容%s：\n````\n%s\n````\n", att.Name, note, strings.TrimRight(att.Text, "\n"))
+	}
+	return b.String()
 }
 
 func trim(s string, max int) string {
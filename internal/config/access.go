@@ -0,0 +1,109 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Roles, from least to most privileged.
+const (
+	RoleViewer = "viewer"
+	RoleRunner = "runner"
+	RoleAdmin  = "admin"
+)
+
+// Permissions checked by the runner.
+const (
+	PermView         = "view"          // /status, /diff of the repo's tasks
+	PermRun          = "run"           // submit and retry tasks
+	PermPush         = "push"          // push task commits to push_remote
+	PermPR           = "pr"            // open pull/merge requests
+	PermCancelOthers = "cancel_others" // cancel tasks submitted by others
+	PermConfig       = "config"        // manage the runner's configuration
+)
+
+// Roles lists the roles from least to most privileged.
+var Roles = []string{RoleViewer, RoleRunner, RoleAdmin}
+
+// DefaultRolePermissions are the permissions of each role unless access.roles
+// redefines them.
+var DefaultRolePermissions = map[string][]string{
+	RoleViewer: {PermView},
+	RoleRunner: {PermView, PermRun, PermPush, PermPR},
+	RoleAdmin:  {PermView, PermRun, PermPush, PermPR, PermCancelOthers, PermConfig},
+}
+
+var permissions = []string{PermView, PermRun, PermPush, PermPR, PermCancelOthers, PermConfig}
+
+// Grant gives Role to the listed users (open_id), to everyone writing in the
+// listed chats (chat_id) and to members of the listed departments
+// (open_department_id).
+type Grant struct {
+	Role        string
+	Users       []string
+	Chats       []string
+	Departments []string
+}
+
+// Access is who may use the runner: runner-wide grants, with per-repo grants
+// in RepoConfig.Access. RolePermissions replaces the default permissions of
+// the roles it names.
+type Access struct {
+	Grants          []Grant
+	RolePermissions map[string][]string
+}
+
+// ValidateAccess reports unknown roles and permissions, grants naming nobody
+// and a configuration that grants nothing to anyone.
+func ValidateAccess(acc Access, repos []RepoConfig) error {
+	var errs []error
+	granted := false
+	check := func(where string, grants []Grant) {
+		for i, g := range grants {
+			w := fmt.Sprintf("%s[%d]", where, i)
+			if !knownRole(g.Role) {
+				errs = append(errs, fmt.Errorf("%s: unknown role %q (roles: viewer, runner, admin)", w, g.Role))
+			}
+			if len(g.Users)+len(g.Chats)+len(g.Departments) == 0 {
+				errs = append(errs, fmt.Errorf("%s: grant needs users, chats or departments", w))
+			}
+			granted = true
+		}
+	}
+	check("access.grants", acc.Grants)
+	for _, rc := range repos {
+		check(fmt.Sprintf("repos (%s): access", rc.Name), rc.Access)
+	}
+	for role, perms := range acc.RolePermissions {
+		if !knownRole(role) {
+			errs = append(errs, fmt.Errorf("access.roles: unknown role %q", role))
+		}
+		for _, p := range perms {
+			if !knownPermission(p) {
+				errs = append(errs, fmt.Errorf("access.roles.%s: unknown permission %q (permissions: view, run, push, pr, cancel_others, config)", role, p))
+			}
+		}
+	}
+	if !granted {
+		errs = append(errs, errors.New("access: no users are granted access (set allowlist open_ids or access grants)"))
+	}
+	return errors.Join(errs...)
+}
+
+func knownRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func knownPermission(p string) bool {
+	for _, k := range permissions {
+		if k == p {
+			return true
+		}
+	}
+	return false
+}
@@ -1,14 +1,15 @@
 package config
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 type RepoConfig struct {
@@ -16,41 +17,254 @@ type RepoConfig struct {
 	LocalPath     string
 	Allowed       bool
 	DefaultBranch string
+	// AutoCommit commits successful task results in the task worktree. When
+	// PushRemote is also set the commit is pushed to PushBranchPrefix+task_id.
+	AutoCommit       bool
+	PushRemote       string
+	PushBranchPrefix string
+	// CodeHost ("github" or "gitlab") opens a pull/merge request for pushed
+	// task branches. The API token is read from the CodeHostTokenEnv variable.
+	CodeHost         string
+	CodeHostURL      string
+	CodeHostProject  string
+	CodeHostTokenEnv string
+	// Agent selects the coding-agent backend (codex, claude, aider, script)
+	// for the repo's tasks; AgentBin and AgentArgs override its executable
+	// and add flags.
+	Agent     string
+	AgentBin  string
+	AgentArgs []string
+	// TestCmd replaces the runtime default test command for the repo's tasks
+	// (#test_cmd= still wins). SetupCmd runs in a fresh worktree before the
+	// agent, LintCmd after the tests; a failing lint fails the task.
+	TestCmd  string
+	SetupCmd string
+	LintCmd  string
+	// Timeout, when set, replaces the global agent timeout.
+	Timeout time.Duration
+	// Env is added to the environment of the agent and of the setup, test
+	// and lint commands.
+	Env map[string]string
+	// PromptPreamble is put before the runner's own prompt, e.g. to describe
+	// the repo's conventions.
+	PromptPreamble string
+	// AllowedBranches are path.Match patterns a task's #branch= must match;
+	// empty allows any branch.
+	AllowedBranches []string
+	// Access grants roles on this repo in addition to the runner-wide ones.
+	Access []Grant
 }
 
+// Event intake modes selectable with RUNNER_EVENT_MODE.
+const (
+	EventModePoll     = "poll"
+	EventModeLongConn = "ws"
+	EventModeWebhook  = "webhook"
+)
+
+// Worktree cleanup policies selectable with RUNNER_WORKTREE_CLEANUP.
+const (
+	CleanupAlways    = "always"
+	CleanupOnSuccess = "on_success"
+	CleanupNever     = "never"
+)
+
 type Runtime struct {
-	FeishuAppID      string
-	FeishuAppSecret  string
-	CodexBin         string
-	PollInterval     time.Duration
+	// ConfigFile is the unified runner.yaml in use, "" when there is none.
+	ConfigFile        string
+	FeishuAppID       string
+	FeishuAppSecret   string
+	VerificationToken string
+	EncryptKey        string
+	CodexBin          string
+	CodexJSON         bool
+	DefaultAgent      string
+	EventMode         string
+	PollInterval      time.Duration
+	// PollChats are polled for messages in addition to the group chats the
+	// bot is in. Private chats are only polled when listed here.
+	PollChats        []string
+	WebhookAddr      string
+	WebhookPath      string
 	WorkDir          string
 	ReposFile        string
 	AllowListFile    string
 	DefaultTestCmd   string
 	ExecutionTimeout time.Duration
+	Workers          int
+	// RepairAttempts is how many times the agent is re-run with the failing
+	// test output; RepairBudget, when set, caps the task's total agent and
+	// test time across attempts.
+	RepairAttempts  int
+	RepairBudget    time.Duration
+	WorktreeCleanup string
+	RecoveryCleanup bool
+	// AdminChatID receives configuration reload results; "" only logs them.
+	AdminChatID string
+	// UploadArtifacts sends each finished task's full agent log, test log
+	// and patch as file messages, gzipped when large; files still over
+	// UploadMaxMB are not sent.
+	UploadArtifacts bool
+	UploadMaxMB     int
 }
 
-func LoadRuntime() (Runtime, error) {
-	pollSec := readIntEnv("RUNNER_POLL_INTERVAL_SEC", 8)
-	timeoutMin := readIntEnv("RUNNER_EXEC_TIMEOUT_MIN", 30)
-	wd := os.Getenv("RUNNER_WORK_DIR")
-	if wd == "" {
-		wd = "./runner-data"
+// Config is the runner's complete configuration.
+type Config struct {
+	Runtime Runtime
+	Repos   []RepoConfig
+	Access  Access
+}
+
+// maxUploadMB is the largest file Feishu's upload API accepts.
+const maxUploadMB = 30
+
+// defaultConfigFile is read when RUNNER_CONFIG is unset and the file exists.
+const defaultConfigFile = "./runner.yaml"
+
+// Load reads the configuration. Settings come from the unified runner.yaml
+// (RUNNER_CONFIG) when present, with environment variables taking
+// precedence; repos and access fall back to the separate repos.yaml and
+// allowlist.yaml when runner.yaml has no such section.
+func Load() (Config, error) {
+	path, explicit := os.LookupEnv("RUNNER_CONFIG")
+	if path == "" {
+		path, explicit = defaultConfigFile, false
+	}
+	var f fileConfig
+	if _, err := os.Stat(path); err == nil || explicit {
+		if err := decodeFile(path, &f); err != nil {
+			return Config{}, err
+		}
+	} else {
+		path = ""
+	}
+
+	rt, err := loadRuntime(f)
+	if err != nil {
+		return Config{}, err
+	}
+	rt.ConfigFile = path
+	cfg := Config{Runtime: rt}
+
+	reposFile := path
+	if f.Repos != nil {
+		cfg.Repos = repoConfigs(f.Repos)
+	} else {
+		if cfg.Repos, err = LoadRepos(rt.ReposFile); err != nil {
+			return Config{}, err
+		}
+		reposFile = rt.ReposFile
+	}
+	if err := ValidateRepos(cfg.Repos); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", reposFile, err)
 	}
+
+	accessPath := path
+	if f.Access != nil || f.AllowList != nil {
+		cfg.Access = accessConfig(f.AllowList, f.Access)
+	} else {
+		if cfg.Access, err = LoadAccess(rt.AllowListFile); err != nil {
+			return Config{}, err
+		}
+		accessPath = rt.AllowListFile
+	}
+	if err := ValidateAccess(cfg.Access, cfg.Repos); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", accessPath, err)
+	}
+	return cfg, nil
+}
+
+// loadRuntime applies runner.yaml's runtime and policies sections, then the
+// environment, over the defaults.
+func loadRuntime(f fileConfig) (Runtime, error) {
 	cfg := Runtime{
-		FeishuAppID:      os.Getenv("FEISHU_APP_ID"),
-		FeishuAppSecret:  os.Getenv("FEISHU_APP_SECRET"),
-		CodexBin:         getenvDefault("CODEX_BIN", "codex"),
-		PollInterval:     time.Duration(pollSec) * time.Second,
-		WorkDir:          wd,
-		ReposFile:        getenvDefault("RUNNER_REPOS_FILE", "./repos.yaml"),
-		AllowListFile:    getenvDefault("RUNNER_ALLOWLIST_FILE", "./allowlist.yaml"),
-		DefaultTestCmd:   getenvDefault("RUNNER_DEFAULT_TEST_CMD", "go test ./..."),
-		ExecutionTimeout: time.Duration(timeoutMin) * time.Minute,
+		CodexBin:         "codex",
+		DefaultAgent:     "codex",
+		EventMode:        EventModePoll,
+		PollInterval:     8 * time.Second,
+		WebhookAddr:      ":8080",
+		WebhookPath:      "/feishu/events",
+		WorkDir:          "./runner-data",
+		ReposFile:        "./repos.yaml",
+		AllowListFile:    "./allowlist.yaml",
+		DefaultTestCmd:   "go test ./...",
+		ExecutionTimeout: 30 * time.Minute,
+		Workers:          2,
+		WorktreeCleanup:  CleanupOnSuccess,
+		UploadArtifacts:  true,
+		UploadMaxMB:      maxUploadMB,
+	}
+	f.Runtime.apply(&cfg)
+	f.Policies.apply(&cfg)
+
+	var env envReader
+	env.str(&cfg.FeishuAppID, "FEISHU_APP_ID")
+	env.str(&cfg.FeishuAppSecret, "FEISHU_APP_SECRET")
+	env.str(&cfg.VerificationToken, "FEISHU_VERIFICATION_TOKEN")
+	env.str(&cfg.EncryptKey, "FEISHU_ENCRYPT_KEY")
+	env.str(&cfg.CodexBin, "CODEX_BIN")
+	env.boolean(&cfg.CodexJSON, "CODEX_JSON")
+	env.str(&cfg.DefaultAgent, "RUNNER_DEFAULT_AGENT")
+	env.str(&cfg.EventMode, "RUNNER_EVENT_MODE")
+	env.duration(&cfg.PollInterval, "RUNNER_POLL_INTERVAL_SEC", time.Second)
+	env.list(&cfg.PollChats, "RUNNER_POLL_CHATS")
+	env.str(&cfg.WebhookAddr, "RUNNER_WEBHOOK_ADDR")
+	env.str(&cfg.WebhookPath, "RUNNER_WEBHOOK_PATH")
+	env.str(&cfg.WorkDir, "RUNNER_WORK_DIR")
+	env.str(&cfg.ReposFile, "RUNNER_REPOS_FILE")
+	env.str(&cfg.AllowListFile, "RUNNER_ALLOWLIST_FILE")
+	env.str(&cfg.DefaultTestCmd, "RUNNER_DEFAULT_TEST_CMD")
+	env.duration(&cfg.ExecutionTimeout, "RUNNER_EXEC_TIMEOUT_MIN", time.Minute)
+	env.integer(&cfg.Workers, "RUNNER_WORKERS")
+	env.integer(&cfg.RepairAttempts, "RUNNER_REPAIR_ATTEMPTS")
+	env.duration(&cfg.RepairBudget, "RUNNER_REPAIR_BUDGET_MIN", time.Minute)
+	env.str(&cfg.WorktreeCleanup, "RUNNER_WORKTREE_CLEANUP")
+	env.boolean(&cfg.RecoveryCleanup, "RUNNER_RECOVERY_CLEANUP")
+	env.str(&cfg.AdminChatID, "RUNNER_ADMIN_CHAT_ID")
+	env.boolean(&cfg.UploadArtifacts, "RUNNER_UPLOAD_ARTIFACTS")
+	env.integer(&cfg.UploadMaxMB, "RUNNER_UPLOAD_MAX_MB")
+	if err := errors.Join(env.errs...); err != nil {
+		return Runtime{}, err
 	}
+	cfg.DefaultAgent = strings.ToLower(cfg.DefaultAgent)
+	cfg.EventMode = strings.ToLower(cfg.EventMode)
+	cfg.WorktreeCleanup = strings.ToLower(cfg.WorktreeCleanup)
+
 	if cfg.FeishuAppID == "" || cfg.FeishuAppSecret == "" {
 		return Runtime{}, errors.New("FEISHU_APP_ID and FEISHU_APP_SECRET must be set")
 	}
+	if cfg.Workers < 1 {
+		return Runtime{}, fmt.Errorf("RUNNER_WORKERS must be at least 1, got %d", cfg.Workers)
+	}
+	if cfg.PollInterval <= 0 {
+		return Runtime{}, fmt.Errorf("RUNNER_POLL_INTERVAL_SEC must be positive, got %d", int(cfg.PollInterval/time.Second))
+	}
+	if cfg.ExecutionTimeout <= 0 {
+		return Runtime{}, fmt.Errorf("RUNNER_EXEC_TIMEOUT_MIN must be positive, got %d", int(cfg.ExecutionTimeout/time.Minute))
+	}
+	if cfg.RepairAttempts < 0 {
+		return Runtime{}, fmt.Errorf("RUNNER_REPAIR_ATTEMPTS must not be negative, got %d", cfg.RepairAttempts)
+	}
+	if cfg.RepairBudget < 0 {
+		return Runtime{}, fmt.Errorf("RUNNER_REPAIR_BUDGET_MIN must not be negative, got %d", int(cfg.RepairBudget/time.Minute))
+	}
+	if cfg.UploadMaxMB < 1 || cfg.UploadMaxMB > maxUploadMB {
+		return Runtime{}, fmt.Errorf("RUNNER_UPLOAD_MAX_MB must be between 1 and %d, got %d", maxUploadMB, cfg.UploadMaxMB)
+	}
+	switch cfg.WorktreeCleanup {
+	case CleanupAlways, CleanupOnSuccess, CleanupNever:
+	default:
+		return Runtime{}, fmt.Errorf("RUNNER_WORKTREE_CLEANUP must be one of %q, %q, %q; got %q", CleanupAlways, CleanupOnSuccess, CleanupNever, cfg.WorktreeCleanup)
+	}
+	switch cfg.EventMode {
+	case EventModePoll, EventModeLongConn:
+	case EventModeWebhook:
+		if cfg.VerificationToken == "" && cfg.EncryptKey == "" {
+			return Runtime{}, errors.New("webhook mode requires FEISHU_VERIFICATION_TOKEN or FEISHU_ENCRYPT_KEY")
+		}
+	default:
+		return Runtime{}, fmt.Errorf("RUNNER_EVENT_MODE must be one of %q, %q, %q; got %q", EventModePoll, EventModeLongConn, EventModeWebhook, cfg.EventMode)
+	}
 	if err := os.MkdirAll(cfg.WorkDir, 0o755); err != nil {
 		return Runtime{}, fmt.Errorf("create workdir: %w", err)
 	}
@@ -61,112 +275,117 @@ func LoadRuntime() (Runtime, error) {
 }
 
 func LoadRepos(path string) ([]RepoConfig, error) {
-	m, err := parseSimpleYAML(path)
-	if err != nil {
-		return nil, err
+	var f struct {
+		Repos []repoFile `yaml:"repos"`
 	}
-	items, ok := m["repos"].([]map[string]string)
-	if !ok {
-		return nil, errors.New("repos.yaml must contain repos list")
+	if err := decodeFile(path, &f); err != nil {
+		return nil, err
 	}
-	out := make([]RepoConfig, 0, len(items))
-	for _, it := range items {
-		out = append(out, RepoConfig{
-			Name:          it["name"],
-			LocalPath:     it["local_path"],
-			Allowed:       strings.EqualFold(it["allowed"], "true"),
-			DefaultBranch: it["default_branch"],
-		})
+	if f.Repos == nil {
+		return nil, fmt.Errorf("%s: must contain repos list", path)
 	}
-	return out, nil
+	return repoConfigs(f.Repos), nil
 }
 
-func LoadAllowList(path string) (map[string]struct{}, error) {
-	m, err := parseSimpleYAML(path)
-	if err != nil {
-		return nil, err
+// LoadAccess reads allowlist.yaml: open_ids (runner role everywhere) and
+// optionally role grants and permission overrides.
+func LoadAccess(path string) (Access, error) {
+	var f accessFile
+	if err := decodeFile(path, &f); err != nil {
+		return Access{}, err
 	}
-	vals, ok := m["open_ids"].([]string)
-	if !ok {
-		return nil, errors.New("allowlist.yaml must contain open_ids list")
+	if f.OpenIDs == nil && f.Grants == nil {
+		return Access{}, fmt.Errorf("%s: must contain open_ids or grants list", path)
 	}
-	set := make(map[string]struct{}, len(vals))
-	for _, id := range vals {
-		id = strings.TrimSpace(id)
-		if id != "" {
-			set[id] = struct{}{}
-		}
-	}
-	return set, nil
+	return accessConfig(&f), nil
 }
 
-// parseSimpleYAML supports just the subset used by repos.yaml and allowlist.yaml.
-func parseSimpleYAML(path string) (map[string]any, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("open %s: %w", path, err)
-	}
-	defer f.Close()
-	root := map[string]any{}
-	s := bufio.NewScanner(f)
-	var currentKey string
-	var currentObj map[string]string
-	for s.Scan() {
-		line := strings.TrimSpace(s.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		if strings.HasSuffix(line, ":") && !strings.HasPrefix(line, "-") {
-			currentKey = strings.TrimSuffix(line, ":")
-			currentObj = nil
-			continue
-		}
-		if strings.HasPrefix(line, "- ") {
-			val := strings.TrimSpace(strings.TrimPrefix(line, "- "))
-			if strings.Contains(val, ":") {
-				parts := strings.SplitN(val, ":", 2)
-				currentObj = map[string]string{strings.TrimSpace(parts[0]): trimVal(parts[1])}
-				list, _ := root[currentKey].([]map[string]string)
-				list = append(list, currentObj)
-				root[currentKey] = list
+// ValidateRepos reports every repo with a missing name or local_path, a
+// local_path that is not an existing directory, or a name used twice.
+func ValidateRepos(repos []RepoConfig) error {
+	if len(repos) == 0 {
+		return errors.New("no repos configured")
+	}
+	var errs []error
+	seen := map[string]int{}
+	for i, rc := range repos {
+		where := fmt.Sprintf("repos[%d]", i)
+		if rc.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: name is required", where))
+		} else {
+			where += " (" + rc.Name + ")"
+			if j, dup := seen[rc.Name]; dup {
+				errs = append(errs, fmt.Errorf("%s: duplicate name, already used by repos[%d]", where, j))
 			} else {
-				list, _ := root[currentKey].([]string)
-				list = append(list, trimVal(val))
-				root[currentKey] = list
+				seen[rc.Name] = i
 			}
-			continue
 		}
-		if strings.Contains(line, ":") && currentObj != nil {
-			parts := strings.SplitN(line, ":", 2)
-			currentObj[strings.TrimSpace(parts[0])] = trimVal(parts[1])
+		for _, pat := range rc.AllowedBranches {
+			if _, err := path.Match(pat, ""); err != nil {
+				errs = append(errs, fmt.Errorf("%s: allowed_branches pattern %q: %w", where, pat, err))
+			}
+		}
+		if rc.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("%s: timeout_min must not be negative", where))
+		}
+		if rc.LocalPath == "" {
+			errs = append(errs, fmt.Errorf("%s: local_path is required", where))
+		} else if st, err := os.Stat(rc.LocalPath); err != nil {
+			errs = append(errs, fmt.Errorf("%s: local_path %s does not exist", where, rc.LocalPath))
+		} else if !st.IsDir() {
+			errs = append(errs, fmt.Errorf("%s: local_path %s is not a directory", where, rc.LocalPath))
 		}
 	}
-	if err := s.Err(); err != nil {
-		return nil, err
-	}
-	return root, nil
+	return errors.Join(errs...)
+}
+
+// envReader overrides settings with the environment variables that are set,
+// collecting malformed values.
+type envReader struct {
+	errs []error
 }
 
-func trimVal(v string) string {
-	v = strings.TrimSpace(v)
-	return strings.Trim(v, `"`)
+func (e *envReader) str(dst *string, key string) {
+	if v := os.Getenv(key); v != "" {
+		*dst = v
+	}
 }
 
-func getenvDefault(key, fallback string) string {
+// list splits the value on commas and whitespace.
+func (e *envReader) list(dst *[]string, key string) {
 	if v := os.Getenv(key); v != "" {
-		return v
+		*dst = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
 	}
-	return fallback
 }
 
-func readIntEnv(key string, fallback int) int {
+func (e *envReader) integer(dst *int, key string) {
 	v := os.Getenv(key)
 	if v == "" {
-		return fallback
+		return
 	}
 	n, err := strconv.Atoi(v)
 	if err != nil {
-		return fallback
+		e.errs = append(e.errs, fmt.Errorf("%s: %q is not an integer", key, v))
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) duration(dst *time.Duration, key string, unit time.Duration) {
+	n := int(*dst / unit)
+	e.integer(&n, key)
+	*dst = time.Duration(n) * unit
+}
+
+func (e *envReader) boolean(dst *bool, key string) {
+	v := os.Getenv(key)
+	if v == "" {
+		return
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q is not a boolean", key, v))
+		return
 	}
-	return n
+	*dst = b
 }
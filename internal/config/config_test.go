@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadRepos(t *testing.T) {
@@ -18,3 +20,189 @@ func TestLoadRepos(t *testing.T) {
 		t.Fatalf("unexpected repos: %+v", repos)
 	}
 }
+
+func TestLoadReposCommitPolicy(t *testing.T) {
+	d := t.TempDir()
+	p := filepath.Join(d, "repos.yaml")
+	_ = os.WriteFile(p, []byte(`repos:
+  - name: aoi
+    local_path: /tmp/aoi
+    auto_commit: true
+    push_remote: origin
+  - name: web
+    local_path: /tmp/web
+    auto_commit: true
+    push_remote: upstream
+    push_branch_prefix: bot/
+`), 0o644)
+	repos, err := LoadRepos(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !repos[0].AutoCommit || repos[0].PushRemote != "origin" || repos[0].PushBranchPrefix != "codex/" {
+		t.Fatalf("unexpected default commit policy: %+v", repos[0])
+	}
+	if repos[1].PushRemote != "upstream" || repos[1].PushBranchPrefix != "bot/" {
+		t.Fatalf("unexpected commit policy: %+v", repos[1])
+	}
+}
+
+func TestLoadReposRunSettings(t *testing.T) {
+	d := t.TempDir()
+	p := filepath.Join(d, "repos.yaml")
+	_ = os.WriteFile(p, []byte(`repos:
+  - name: aoi
+    local_path: /tmp/aoi
+    test_cmd: make test
+    setup_cmd: go mod download
+    lint_cmd: golangci-lint run
+    timeout_min: 45
+    env:
+      GOFLAGS: -mod=mod
+    allowed_branches: feat/* fix/*
+    prompt_preamble: |
+      Use zap for logging.
+`), 0o644)
+	repos, err := LoadRepos(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := repos[0]
+	if rc.TestCmd != "make test" || rc.SetupCmd != "go mod download" || rc.LintCmd != "golangci-lint run" {
+		t.Fatalf("unexpected commands: %+v", rc)
+	}
+	if rc.Timeout != 45*time.Minute || rc.Env["GOFLAGS"] != "-mod=mod" || len(rc.AllowedBranches) != 2 || rc.PromptPreamble != "Use zap for logging." {
+		t.Fatalf("unexpected repo settings: %+v", rc)
+	}
+}
+
+func TestLoadUnifiedConfig(t *testing.T) {
+	d := t.TempDir()
+	p := filepath.Join(d, "runner.yaml")
+	_ = os.WriteFile(p, []byte(`# unified configuration
+runtime:
+  feishu_app_id: cli_test
+  feishu_app_secret: secret   # prefer FEISHU_APP_SECRET in production
+  work_dir: `+filepath.Join(d, "data")+`
+  default_test_cmd: |
+    go vet ./...
+    go test ./...
+policies:
+  workers: 4
+  repair_attempts: 2
+  upload_max_mb: 10
+repos:
+  - name: aoi
+    local_path: `+d+`
+    allowed: true
+    agent: Claude
+    agent_args: [--model, "claude sonnet"]
+    access:
+      - role: viewer
+        departments: od_qa
+allowlist:
+  open_ids: [ou_a, ou_b]
+access:
+  grants:
+    - role: Admin
+      users: [ou_lead]
+  roles:
+    runner: [view, run]
+`), 0o644)
+	t.Setenv("RUNNER_CONFIG", p)
+	t.Setenv("RUNNER_WORKERS", "6")
+	t.Setenv("RUNNER_POLL_CHATS", "oc_a, oc_b")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := cfg.Runtime
+	if rt.FeishuAppSecret != "secret" || rt.Workers != 6 || rt.RepairAttempts != 2 || rt.ConfigFile != p || !rt.UploadArtifacts || rt.UploadMaxMB != 10 || len(rt.PollChats) != 2 || rt.PollChats[1] != "oc_b" {
+		t.Fatalf("unexpected runtime: %+v", rt)
+	}
+	if rt.DefaultTestCmd != "go vet ./...\ngo test ./...\n" {
+		t.Fatalf("multiline test command = %q", rt.DefaultTestCmd)
+	}
+	if len(cfg.Repos) != 1 || cfg.Repos[0].Agent != "claude" || len(cfg.Repos[0].AgentArgs) != 2 || cfg.Repos[0].AgentArgs[1] != "claude sonnet" {
+		t.Fatalf("unexpected repos: %+v", cfg.Repos)
+	}
+	grants := cfg.Access.Grants
+	if len(grants) != 2 || grants[0].Role != RoleRunner || len(grants[0].Users) != 2 || grants[1].Role != RoleAdmin {
+		t.Fatalf("unexpected grants: %+v", grants)
+	}
+	if len(cfg.Access.RolePermissions[RoleRunner]) != 2 || cfg.Repos[0].Access[0].Departments[0] != "od_qa" {
+		t.Fatalf("unexpected access: %+v / %+v", cfg.Access, cfg.Repos[0].Access)
+	}
+}
+
+func TestLoadReportsValidationErrors(t *testing.T) {
+	d := t.TempDir()
+	p := filepath.Join(d, "runner.yaml")
+	base := "runtime:\n  feishu_app_id: a\n  feishu_app_secret: b\n  work_dir: " + filepath.Join(d, "data") + "\nallowlist:\n  open_ids: []\n"
+	t.Setenv("RUNNER_CONFIG", p)
+
+	_ = os.WriteFile(p, []byte(base+"repos:\n  - name: aoi\n    local_path: "+d+"\n    locl_path: typo\n"), 0o644)
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "runner.yaml: line 10: field locl_path not found") {
+		t.Fatalf("want unknown key error with line, got %v", err)
+	}
+
+	_ = os.WriteFile(p, []byte(base+"repos:\n  - name: aoi\n    local_path: "+d+"\n    access:\n      - role: owner\n        users: [ou_a]\naccess:\n  roles:\n    viewer: [view, deploy]\n"), 0o644)
+	_, err := Load()
+	for _, want := range []string{`repos (aoi): access[0]: unknown role "owner"`, `access.roles.viewer: unknown permission "deploy"`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q: %v", want, err)
+		}
+	}
+
+	_ = os.WriteFile(p, []byte(base+`repos:
+  - name: aoi
+  - name: aoi
+    local_path: /nonexistent/aoi
+  - name: web
+    local_path: `+p+`
+`), 0o644)
+	_, err = Load()
+	if err == nil {
+		t.Fatal("want validation errors")
+	}
+	for _, want := range []string{
+		"repos[0] (aoi): local_path is required",
+		"repos[1] (aoi): duplicate name, already used by repos[0]",
+		"repos[1] (aoi): local_path /nonexistent/aoi does not exist",
+		"repos[2] (web): local_path " + p + " is not a directory",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error lacks %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadRejectsBadDurations(t *testing.T) {
+	d := t.TempDir()
+	p := filepath.Join(d, "runner.yaml")
+	base := "runtime:\n  feishu_app_id: a\n  feishu_app_secret: b\n  work_dir: " + filepath.Join(d, "data") + "\n"
+	t.Setenv("RUNNER_CONFIG", p)
+
+	_ = os.WriteFile(p, []byte(base+"  poll_interval_sec: 0\n"), 0o644)
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "RUNNER_POLL_INTERVAL_SEC must be positive, got 0") {
+		t.Fatalf("want poll interval error from the file, got %v", err)
+	}
+
+	_ = os.WriteFile(p, []byte(base), 0o644)
+	for key, want := range map[string]string{
+		"RUNNER_POLL_INTERVAL_SEC": "RUNNER_POLL_INTERVAL_SEC must be positive, got -5",
+		"RUNNER_EXEC_TIMEOUT_MIN":  "RUNNER_EXEC_TIMEOUT_MIN must be positive, got -5",
+		"RUNNER_REPAIR_BUDGET_MIN": "RUNNER_REPAIR_BUDGET_MIN must not be negative, got -5",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, "-5")
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), want) {
+				t.Fatalf("want %q, got %v", want, err)
+			}
+		})
+	}
+	t.Setenv("RUNNER_EXEC_TIMEOUT_MIN", "0")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "RUNNER_EXEC_TIMEOUT_MIN must be positive, got 0") {
+		t.Fatalf("want exec timeout error, got %v", err)
+	}
+}
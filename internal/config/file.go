@@ -0,0 +1,274 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the layout of runner.yaml. Every section is optional.
+type fileConfig struct {
+	Runtime   runtimeFile  `yaml:"runtime"`
+	Policies  policiesFile `yaml:"policies"`
+	Repos     []repoFile   `yaml:"repos"`
+	Access    *accessFile  `yaml:"access"`
+	AllowList *accessFile  `yaml:"allowlist"`
+}
+
+type runtimeFile struct {
+	FeishuAppID       string     `yaml:"feishu_app_id"`
+	FeishuAppSecret   string     `yaml:"feishu_app_secret"`
+	VerificationToken string     `yaml:"verification_token"`
+	EncryptKey        string     `yaml:"encrypt_key"`
+	CodexBin          string     `yaml:"codex_bin"`
+	CodexJSON         *bool      `yaml:"codex_json"`
+	DefaultAgent      string     `yaml:"default_agent"`
+	EventMode         string     `yaml:"event_mode"`
+	PollIntervalSec   *int       `yaml:"poll_interval_sec"`
+	PollChats         stringList `yaml:"poll_chats"`
+	WebhookAddr       string     `yaml:"webhook_addr"`
+	WebhookPath       string     `yaml:"webhook_path"`
+	WorkDir           string     `yaml:"work_dir"`
+	DefaultTestCmd    string     `yaml:"default_test_cmd"`
+	AdminChatID       string     `yaml:"admin_chat_id"`
+}
+
+func (f runtimeFile) apply(cfg *Runtime) {
+	setString(&cfg.FeishuAppID, f.FeishuAppID)
+	setString(&cfg.FeishuAppSecret, f.FeishuAppSecret)
+	setString(&cfg.VerificationToken, f.VerificationToken)
+	setString(&cfg.EncryptKey, f.EncryptKey)
+	setString(&cfg.CodexBin, f.CodexBin)
+	if f.CodexJSON != nil {
+		cfg.CodexJSON = *f.CodexJSON
+	}
+	setString(&cfg.DefaultAgent, f.DefaultAgent)
+	setString(&cfg.EventMode, f.EventMode)
+	setDuration(&cfg.PollInterval, f.PollIntervalSec, time.Second)
+	if len(f.PollChats) > 0 {
+		cfg.PollChats = f.PollChats
+	}
+	setString(&cfg.WebhookAddr, f.WebhookAddr)
+	setString(&cfg.WebhookPath, f.WebhookPath)
+	setString(&cfg.WorkDir, f.WorkDir)
+	setString(&cfg.DefaultTestCmd, f.DefaultTestCmd)
+	setString(&cfg.AdminChatID, f.AdminChatID)
+}
+
+// policiesFile holds how tasks are executed, as opposed to where the runner
+// connects and stores data.
+type policiesFile struct {
+	Workers         *int   `yaml:"workers"`
+	ExecTimeoutMin  *int   `yaml:"exec_timeout_min"`
+	WorktreeCleanup string `yaml:"worktree_cleanup"`
+	RecoveryCleanup *bool  `yaml:"recovery_cleanup"`
+	RepairAttempts  *int   `yaml:"repair_attempts"`
+	RepairBudgetMin *int   `yaml:"repair_budget_min"`
+	UploadArtifacts *bool  `yaml:"upload_artifacts"`
+	UploadMaxMB     *int   `yaml:"upload_max_mb"`
+}
+
+func (f policiesFile) apply(cfg *Runtime) {
+	if f.Workers != nil {
+		cfg.Workers = *f.Workers
+	}
+	setDuration(&cfg.ExecutionTimeout, f.ExecTimeoutMin, time.Minute)
+	setString(&cfg.WorktreeCleanup, f.WorktreeCleanup)
+	if f.RecoveryCleanup != nil {
+		cfg.RecoveryCleanup = *f.RecoveryCleanup
+	}
+	if f.RepairAttempts != nil {
+		cfg.RepairAttempts = *f.RepairAttempts
+	}
+	setDuration(&cfg.RepairBudget, f.RepairBudgetMin, time.Minute)
+	if f.UploadArtifacts != nil {
+		cfg.UploadArtifacts = *f.UploadArtifacts
+	}
+	if f.UploadMaxMB != nil {
+		cfg.UploadMaxMB = *f.UploadMaxMB
+	}
+}
+
+type repoFile struct {
+	Name             string     `yaml:"name"`
+	LocalPath        string     `yaml:"local_path"`
+	Allowed          bool       `yaml:"allowed"`
+	DefaultBranch    string     `yaml:"default_branch"`
+	AutoCommit       bool       `yaml:"auto_commit"`
+	PushRemote       string     `yaml:"push_remote"`
+	PushBranchPrefix string     `yaml:"push_branch_prefix"`
+	CodeHost         string     `yaml:"code_host"`
+	CodeHostURL      string     `yaml:"code_host_url"`
+	CodeHostProject  string     `yaml:"code_host_project"`
+	CodeHostTokenEnv string     `yaml:"code_host_token_env"`
+	Agent            string     `yaml:"agent"`
+	AgentBin         string     `yaml:"agent_bin"`
+	AgentArgs        stringList `yaml:"agent_args"`
+
+	TestCmd         string            `yaml:"test_cmd"`
+	SetupCmd        string            `yaml:"setup_cmd"`
+	LintCmd         string            `yaml:"lint_cmd"`
+	TimeoutMin      int               `yaml:"timeout_min"`
+	Env             map[string]string `yaml:"env"`
+	PromptPreamble  string            `yaml:"prompt_preamble"`
+	AllowedBranches stringList        `yaml:"allowed_branches"`
+	Access          []grantFile       `yaml:"access"`
+}
+
+func repoConfigs(items []repoFile) []RepoConfig {
+	out := make([]RepoConfig, 0, len(items))
+	for _, it := range items {
+		prefix := it.PushBranchPrefix
+		if prefix == "" {
+			prefix = "codex/"
+		}
+		host := strings.ToLower(it.CodeHost)
+		tokenEnv := it.CodeHostTokenEnv
+		if host != "" && tokenEnv == "" {
+			tokenEnv = strings.ToUpper(host) + "_TOKEN"
+		}
+		out = append(out, RepoConfig{
+			Name:             it.Name,
+			LocalPath:        it.LocalPath,
+			Allowed:          it.Allowed,
+			DefaultBranch:    it.DefaultBranch,
+			AutoCommit:       it.AutoCommit,
+			PushRemote:       it.PushRemote,
+			PushBranchPrefix: prefix,
+			CodeHost:         host,
+			CodeHostURL:      it.CodeHostURL,
+			CodeHostProject:  it.CodeHostProject,
+			CodeHostTokenEnv: tokenEnv,
+			Agent:            strings.ToLower(it.Agent),
+			AgentBin:         it.AgentBin,
+			AgentArgs:        it.AgentArgs,
+			TestCmd:          strings.TrimSpace(it.TestCmd),
+			SetupCmd:         strings.TrimSpace(it.SetupCmd),
+			LintCmd:          strings.TrimSpace(it.LintCmd),
+			Timeout:          time.Duration(it.TimeoutMin) * time.Minute,
+			Env:              it.Env,
+			PromptPreamble:   strings.TrimSpace(it.PromptPreamble),
+			AllowedBranches:  it.AllowedBranches,
+			Access:           grants(it.Access),
+		})
+	}
+	return out
+}
+
+// accessFile is the allowlist.yaml layout, also used for the access and
+// allowlist sections of runner.yaml. open_ids is shorthand for a runner
+// grant.
+type accessFile struct {
+	OpenIDs []string            `yaml:"open_ids"`
+	Grants  []grantFile         `yaml:"grants"`
+	Roles   map[string][]string `yaml:"roles"`
+}
+
+type grantFile struct {
+	Role        string     `yaml:"role"`
+	Users       stringList `yaml:"users"`
+	Chats       stringList `yaml:"chats"`
+	Departments stringList `yaml:"departments"`
+}
+
+// accessConfig folds the given files into one Access.
+func accessConfig(files ...*accessFile) Access {
+	var acc Access
+	for _, f := range files {
+		if f == nil {
+			continue
+		}
+		if ids := trimmed(f.OpenIDs); len(ids) > 0 {
+			acc.Grants = append(acc.Grants, Grant{Role: RoleRunner, Users: ids})
+		}
+		acc.Grants = append(acc.Grants, grants(f.Grants)...)
+		for role, perms := range f.Roles {
+			if acc.RolePermissions == nil {
+				acc.RolePermissions = map[string][]string{}
+			}
+			acc.RolePermissions[strings.ToLower(role)] = perms
+		}
+	}
+	return acc
+}
+
+func grants(items []grantFile) []Grant {
+	var out []Grant
+	for _, g := range items {
+		out = append(out, Grant{
+			Role:        strings.ToLower(strings.TrimSpace(g.Role)),
+			Users:       trimmed(g.Users),
+			Chats:       trimmed(g.Chats),
+			Departments: trimmed(g.Departments),
+		})
+	}
+	return out
+}
+
+func trimmed(ids []string) []string {
+	var out []string
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// stringList accepts either a YAML list or a space-separated string, so
+// `agent_args: --model o3` and `agent_args: [--model, o3]` are equivalent.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*l = strings.Fields(n.Value)
+		return nil
+	}
+	var items []string
+	if err := n.Decode(&items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+// decodeFile strictly decodes the YAML file at path into out: unknown keys
+// and mistyped values are errors naming the file and line.
+func decodeFile(path string, out any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		var te *yaml.TypeError
+		if errors.As(err, &te) {
+			errs := make([]error, 0, len(te.Errors))
+			for _, e := range te.Errors {
+				errs = append(errs, fmt.Errorf("%s: %s", path, e))
+			}
+			return errors.Join(errs...)
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func setString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+func setDuration(dst *time.Duration, v *int, unit time.Duration) {
+	if v != nil {
+		*dst = time.Duration(*v) * unit
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -21,125 +22,438 @@ const baseURL = "https://open.feishu.cn/open-apis"
 type Client struct {
 	appID     string
 	appSecret string
+	baseURL   string
 	http      *http.Client
 
 	mu          sync.Mutex
 	token       string
 	tokenExpire time.Time
+	botOpenID   string
+	chatTypes   map[string]string
 }
 
 func NewClient(appID, appSecret string) *Client {
 	return &Client{
 		appID:     appID,
 		appSecret: appSecret,
+		baseURL:   baseURL,
 		http:      &http.Client{Timeout: 20 * time.Second},
+		chatTypes: map[string]string{},
 	}
 }
 
-func (c *Client) FetchMessages(ctx context.Context, startTime time.Time, pageToken string) ([]model.Message, string, error) {
-	token, err := c.getToken(ctx)
-	if err != nil {
-		return nil, "", err
-	}
-	u, _ := url.Parse(baseURL + "/im/v1/messages")
-	q := u.Query()
-	q.Set("page_size", "20")
+// SetBaseURL points the client at another open API host, e.g.
+// https://open.larksuite.com/open-apis for Lark.
+func (c *Client) SetBaseURL(u string) {
+	c.baseURL = strings.TrimSuffix(u, "/")
+}
+
+// messagePageSize is the largest page the message list API returns.
+const messagePageSize = 50
+
+// FetchMessages returns one page of the messages in chatID created from
+// startTime on, oldest first, and the token of the next page ("" when this
+// was the last one). Messages without usable text are left out.
+func (c *Client) FetchMessages(ctx context.Context, chatID string, startTime time.Time, pageToken string) ([]model.Message, string, error) {
+	q := url.Values{}
+	q.Set("container_id_type", "chat")
+	q.Set("container_id", chatID)
+	q.Set("page_size", strconv.Itoa(messagePageSize))
 	q.Set("sort_type", "ByCreateTimeAsc")
 	q.Set("start_time", strconv.FormatInt(startTime.Unix(), 10))
 	if pageToken != "" {
 		q.Set("page_token", pageToken)
 	}
-	u.RawQuery = q.Encode()
+	var data struct {
+		Items     []messageItem `json:"items"`
+		PageToken string        `json:"page_token"`
+		HasMore   bool          `json:"has_more"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/im/v1/messages?"+q.Encode(), nil, &data); err != nil {
+		return nil, "", fmt.Errorf("fetch messages: %w", err)
+	}
+	out := make([]model.Message, 0, len(data.Items))
+	for _, item := range data.Items {
+		// The list includes the bot's own replies.
+		if item.Sender.SenderType == "app" {
+			continue
+		}
+		msg := item.message()
+		if strings.TrimSpace(msg.Text) == "" {
+			continue
+		}
+		var err error
+		if msg.ChatType, err = c.ChatType(ctx, item.ChatID); err != nil {
+			return nil, "", err
+		}
+		out = append(out, msg)
+	}
+	next := ""
+	if data.HasMore {
+		next = data.PageToken
+	}
+	return out, next, nil
+}
 
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+// ListChats returns the IDs of all chats the bot is a member of.
+func (c *Client) ListChats(ctx context.Context) ([]string, error) {
+	var ids []string
+	pageToken := ""
+	for {
+		q := url.Values{}
+		q.Set("page_size", "100")
+		if pageToken != "" {
+			q.Set("page_token", pageToken)
+		}
+		var data struct {
+			Items []struct {
+				ChatID string `json:"chat_id"`
+			} `json:"items"`
+			PageToken string `json:"page_token"`
+			HasMore   bool   `json:"has_more"`
+		}
+		if err := c.call(ctx, http.MethodGet, "/im/v1/chats?"+q.Encode(), nil, &data); err != nil {
+			return nil, fmt.Errorf("list chats: %w", err)
+		}
+		for _, it := range data.Items {
+			ids = append(ids, it.ChatID)
+		}
+		if !data.HasMore || data.PageToken == "" {
+			return ids, nil
+		}
+		pageToken = data.PageToken
+	}
+}
+
+// messageItem is a message as returned by the message list and get APIs.
+type messageItem struct {
+	MessageID string `json:"message_id"`
+	ParentID  string `json:"parent_id"`
+	ChatID    string `json:"chat_id"`
+	Sender    struct {
+		ID         string `json:"id"`
+		IDType     string `json:"id_type"`
+		SenderType string `json:"sender_type"`
+	} `json:"sender"`
+	MsgType    string `json:"msg_type"`
+	CreateTime string `json:"create_time"`
+	Body       struct {
+		Content string `json:"content"`
+	} `json:"body"`
+	Mentions []struct {
+		Key  string `json:"key"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"mentions"`
+}
+
+func (it messageItem) message() model.Message {
+	msg := model.Message{
+		MessageID:    it.MessageID,
+		ParentID:     it.ParentID,
+		ChatID:       it.ChatID,
+		SenderOpenID: it.Sender.ID,
+		Text:         extractText(it.MsgType, it.Body.Content),
+		CreateTime:   parseCreateTime(it.CreateTime),
+		Attachments:  extractAttachments(it.MsgType, it.Body.Content, it.MessageID),
+	}
+	for _, m := range it.Mentions {
+		msg.Mentions = append(msg.Mentions, model.Mention{Key: m.Key, OpenID: m.ID, Name: m.Name})
+	}
+	return msg
+}
+
+// GetMessage fetches a single message, e.g. the one a task instruction
+// replies to.
+func (c *Client) GetMessage(ctx context.Context, messageID string) (model.Message, error) {
+	var out struct {
+		Items []messageItem `json:"items"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/im/v1/messages/"+url.PathEscape(messageID), nil, &out); err != nil {
+		return model.Message{}, err
+	}
+	if len(out.Items) == 0 {
+		return model.Message{}, fmt.Errorf("message %s not found", messageID)
+	}
+	return out.Items[0].message(), nil
+}
+
+// DownloadResource copies a file or image attached to messageID into w.
+// kind is "file" or "image". Resources larger than maxBytes are rejected.
+// It returns the resource's content type.
+func (c *Client) DownloadResource(ctx context.Context, messageID, key, kind string, w io.Writer, maxBytes int64) (string, error) {
+	token, err := c.getToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	path := "/im/v1/messages/" + url.PathEscape(messageID) + "/resources/" + url.PathEscape(key) + "?type=" + url.QueryEscape(kind)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
 	req.Header.Set("Authorization", "Bearer "+token)
 	res, err := c.http.Do(req)
 	if err != nil {
-		return nil, "", fmt.Errorf("fetch messages: %w", err)
+		return "", fmt.Errorf("download %s: %w", key, err)
 	}
 	defer res.Body.Close()
-	body, _ := io.ReadAll(res.Body)
-	if res.StatusCode >= 300 {
-		return nil, "", fmt.Errorf("fetch messages status=%d body=%s", res.StatusCode, string(body))
+	ctype := res.Header.Get("Content-Type")
+	if res.StatusCode >= 300 || strings.HasPrefix(ctype, "application/json") {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return "", fmt.Errorf("download %s status=%d body=%s", key, res.StatusCode, string(body))
+	}
+	if res.ContentLength > maxBytes {
+		return "", fmt.Errorf("download %s: %d bytes exceeds the %d byte limit", key, res.ContentLength, maxBytes)
+	}
+	n, err := io.Copy(w, io.LimitReader(res.Body, maxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("download %s: %w", key, err)
+	}
+	if n > maxBytes {
+		return "", fmt.Errorf("download %s: exceeds the %d byte limit", key, maxBytes)
 	}
+	return ctype, nil
+}
 
-	var payload struct {
-		Code int    `json:"code"`
-		Msg  string `json:"msg"`
+func (c *Client) SendText(ctx context.Context, chatID, text string) error {
+	content, _ := json.Marshal(map[string]string{"text": text})
+	_, err := c.send(ctx, chatID, "text", string(content))
+	return err
+}
+
+// SendCard sends an interactive message card and returns its message ID, which
+// UpdateCard needs to edit the card later. card is marshalled as the card JSON.
+func (c *Client) SendCard(ctx context.Context, chatID string, card any) (string, error) {
+	content, err := json.Marshal(card)
+	if err != nil {
+		return "", fmt.Errorf("encode card: %w", err)
+	}
+	return c.send(ctx, chatID, "interactive", string(content))
+}
+
+// ReplyText answers messageID in its thread.
+func (c *Client) ReplyText(ctx context.Context, messageID, text string) error {
+	content, _ := json.Marshal(map[string]string{"text": text})
+	_, err := c.reply(ctx, messageID, "text", string(content))
+	return err
+}
+
+// ReplyCard answers messageID in its thread with a card and returns the
+// card's message ID.
+func (c *Client) ReplyCard(ctx context.Context, messageID string, card any) (string, error) {
+	content, err := json.Marshal(card)
+	if err != nil {
+		return "", fmt.Errorf("encode card: %w", err)
+	}
+	return c.reply(ctx, messageID, "interactive", string(content))
+}
+
+// UploadFile uploads data as a file named name and returns the file_key
+// for SendFile and ReplyFile. The API accepts files up to 30 MB.
+func (c *Client) UploadFile(ctx context.Context, name string, data []byte) (string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	_ = mw.WriteField("file_type", "stream")
+	_ = mw.WriteField("file_name", name)
+	fw, _ := mw.CreateFormFile("file", name)
+	_, _ = fw.Write(data)
+	_ = mw.Close()
+	body, err := c.doRaw(ctx, http.MethodPost, "/im/v1/files", mw.FormDataContentType(), &buf)
+	if err != nil {
+		return "", err
+	}
+	var r struct {
 		Data struct {
-			Items []struct {
-				MessageID string `json:"message_id"`
-				ChatID    string `json:"chat_id"`
-				Sender    struct {
-					ID struct {
-						OpenID string `json:"open_id"`
-					} `json:"sender_id"`
-				} `json:"sender"`
-				CreateTime string `json:"create_time"`
-				Body       struct {
-					Content string `json:"content"`
-				} `json:"body"`
-			} `json:"items"`
-			PageToken string `json:"page_token"`
-			HasMore   bool   `json:"has_more"`
+			FileKey string `json:"file_key"`
 		} `json:"data"`
 	}
-	if err := json.Unmarshal(body, &payload); err != nil {
-		return nil, "", fmt.Errorf("decode fetch messages: %w", err)
+	if err := json.Unmarshal(body, &r); err != nil || r.Data.FileKey == "" {
+		return "", fmt.Errorf("upload %s: no file_key in %s", name, string(body))
 	}
-	if payload.Code != 0 {
-		return nil, "", fmt.Errorf("fetch messages api error code=%d msg=%s", payload.Code, payload.Msg)
+	return r.Data.FileKey, nil
+}
+
+// SendFile sends an uploaded file to the chat.
+func (c *Client) SendFile(ctx context.Context, chatID, fileKey string) error {
+	content, _ := json.Marshal(map[string]string{"file_key": fileKey})
+	_, err := c.send(ctx, chatID, "file", string(content))
+	return err
+}
+
+// ReplyFile sends an uploaded file in the thread of messageID.
+func (c *Client) ReplyFile(ctx context.Context, messageID, fileKey string) error {
+	content, _ := json.Marshal(map[string]string{"file_key": fileKey})
+	_, err := c.reply(ctx, messageID, "file", string(content))
+	return err
+}
+
+// UpdateCard replaces the content of a card previously sent by the app. Only
+// cards with "update_multi" set can be updated.
+func (c *Client) UpdateCard(ctx context.Context, messageID string, card any) error {
+	content, err := json.Marshal(card)
+	if err != nil {
+		return fmt.Errorf("encode card: %w", err)
 	}
+	payload := map[string]string{"content": string(content)}
+	return c.call(ctx, http.MethodPatch, "/im/v1/messages/"+url.PathEscape(messageID), payload, nil)
+}
 
-	out := make([]model.Message, 0, len(payload.Data.Items))
-	for _, item := range payload.Data.Items {
-		txt := extractText(item.Body.Content)
-		if strings.TrimSpace(txt) == "" {
-			continue
-		}
-		ms, _ := strconv.ParseInt(item.CreateTime, 10, 64)
-		if ms > 1e12 {
-			ms = ms / 1000
-		}
-		out = append(out, model.Message{
-			MessageID:    item.MessageID,
-			ChatID:       item.ChatID,
-			SenderOpenID: item.Sender.ID.OpenID,
-			Text:         txt,
-			CreateTime:   time.Unix(ms, 0),
-		})
+// UserDepartments returns the open department IDs the user belongs to. It
+// needs the contact permission to read user department info.
+func (c *Client) UserDepartments(ctx context.Context, openID string) ([]string, error) {
+	var out struct {
+		User struct {
+			DepartmentIDs []string `json:"department_ids"`
+		} `json:"user"`
 	}
-	next := ""
-	if payload.Data.HasMore {
-		next = payload.Data.PageToken
+	path := "/contact/v3/users/" + url.PathEscape(openID) + "?user_id_type=open_id&department_id_type=open_department_id"
+	if err := c.call(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
 	}
-	return out, next, nil
+	return out.User.DepartmentIDs, nil
 }
 
-func (c *Client) SendText(ctx context.Context, chatID, text string) error {
-	token, err := c.getToken(ctx)
+// BotOpenID returns the app bot's own open_id, which group messages must
+// mention to address the runner. It is fetched once.
+func (c *Client) BotOpenID(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	id := c.botOpenID
+	c.mu.Unlock()
+	if id != "" {
+		return id, nil
+	}
+	body, err := c.do(ctx, http.MethodGet, "/bot/v3/info", nil)
 	if err != nil {
-		return err
+		return "", err
 	}
+	var r struct {
+		Bot struct {
+			OpenID string `json:"open_id"`
+		} `json:"bot"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil || r.Bot.OpenID == "" {
+		return "", fmt.Errorf("bot info: no open_id in %s", string(body))
+	}
+	c.mu.Lock()
+	c.botOpenID = r.Bot.OpenID
+	c.mu.Unlock()
+	return r.Bot.OpenID, nil
+}
+
+// ChatType returns "p2p" or "group" for chatID. Results are cached since a
+// chat's type never changes.
+func (c *Client) ChatType(ctx context.Context, chatID string) (string, error) {
+	c.mu.Lock()
+	t, ok := c.chatTypes[chatID]
+	c.mu.Unlock()
+	if ok {
+		return t, nil
+	}
+	var out struct {
+		ChatMode string `json:"chat_mode"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/im/v1/chats/"+url.PathEscape(chatID), nil, &out); err != nil {
+		return "", err
+	}
+	// Topic chats are groups too.
+	t = "group"
+	if out.ChatMode == model.ChatTypeP2P {
+		t = model.ChatTypeP2P
+	}
+	c.mu.Lock()
+	c.chatTypes[chatID] = t
+	c.mu.Unlock()
+	return t, nil
+}
+
+func (c *Client) reply(ctx context.Context, messageID, msgType, content string) (string, error) {
+	payload := map[string]any{
+		"msg_type":        msgType,
+		"content":         content,
+		"reply_in_thread": true,
+	}
+	var data struct {
+		MessageID string `json:"message_id"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/im/v1/messages/"+url.PathEscape(messageID)+"/reply", payload, &data); err != nil {
+		return "", err
+	}
+	return data.MessageID, nil
+}
+
+func (c *Client) send(ctx context.Context, chatID, msgType, content string) (string, error) {
 	payload := map[string]any{
 		"receive_id": chatID,
-		"msg_type":   "text",
-		"content":    fmt.Sprintf(`{"text":%q}`, text),
+		"msg_type":   msgType,
+		"content":    content,
 	}
-	data, _ := json.Marshal(payload)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/im/v1/messages?receive_id_type=chat_id", bytes.NewReader(data))
+	var data struct {
+		MessageID string `json:"message_id"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/im/v1/messages?receive_id_type=chat_id", payload, &data); err != nil {
+		return "", err
+	}
+	return data.MessageID, nil
+}
+
+// call sends an authorized JSON request to the open API and decodes the
+// response's data field into out when out is non-nil.
+func (c *Client) call(ctx context.Context, method, path string, payload, out any) error {
+	body, err := c.do(ctx, method, path, payload)
+	if err != nil || out == nil {
+		return err
+	}
+	var r struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return fmt.Errorf("decode %s %s: %w", method, path, err)
+	}
+	if len(r.Data) > 0 {
+		if err := json.Unmarshal(r.Data, out); err != nil {
+			return fmt.Errorf("decode %s %s: %w", method, path, err)
+		}
+	}
+	return nil
+}
+
+// do sends an authorized JSON request and returns the response body once
+// the API reports success.
+func (c *Client) do(ctx context.Context, method, path string, payload any) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		data, _ := json.Marshal(payload)
+		body = bytes.NewReader(data)
+	}
+	return c.doRaw(ctx, method, path, "application/json", body)
+}
+
+// doRaw is do for a request body that is already encoded as contentType.
+func (c *Client) doRaw(ctx context.Context, method, path, contentType string, body io.Reader) ([]byte, error) {
+	token, err := c.getToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, _ := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
 	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
 	res, err := c.http.Do(req)
 	if err != nil {
-		return fmt.Errorf("send message: %w", err)
+		return nil, fmt.Errorf("%s %s: %w", method, path, err)
 	}
 	defer res.Body.Close()
-	body, _ := io.ReadAll(res.Body)
+	resBody, _ := io.ReadAll(res.Body)
 	if res.StatusCode >= 300 {
-		return fmt.Errorf("send message status=%d body=%s", res.StatusCode, string(body))
+		return nil, fmt.Errorf("%s %s status=%d body=%s", method, path, res.StatusCode, string(resBody))
 	}
-	return nil
+	var r struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(resBody, &r); err != nil {
+		return nil, fmt.Errorf("decode %s %s: %w", method, path, err)
+	}
+	if r.Code != 0 {
+		return nil, fmt.Errorf("%s %s api error code=%d msg=%s", method, path, r.Code, r.Msg)
+	}
+	return resBody, nil
 }
 
 func (c *Client) getToken(ctx context.Context) (string, error) {
@@ -153,7 +467,7 @@ func (c *Client) getToken(ctx context.Context) (string, error) {
 
 	payload := map[string]string{"app_id": c.appID, "app_secret": c.appSecret}
 	data, _ := json.Marshal(payload)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/auth/v3/tenant_access_token/internal", bytes.NewReader(data))
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/auth/v3/tenant_access_token/internal", bytes.NewReader(data))
 	req.Header.Set("Content-Type", "application/json")
 	res, err := c.http.Do(req)
 	if err != nil {
@@ -183,17 +497,3 @@ func (c *Client) getToken(ctx context.Context) (string, error) {
 	c.mu.Unlock()
 	return t, nil
 }
-
-func extractText(content string) string {
-	if strings.TrimSpace(content) == "" {
-		return ""
-	}
-	var v map[string]any
-	if err := json.Unmarshal([]byte(content), &v); err != nil {
-		return content
-	}
-	if text, ok := v["text"].(string); ok {
-		return text
-	}
-	return content
-}
@@ -0,0 +1,226 @@
+package feishu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/v3/tenant_access_token/internal", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"tenant_access_token":"t-123","expire":7200}`))
+	})
+	mux.HandleFunc("/", handler)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c := NewClient("cli_test", "secret")
+	c.baseURL = srv.URL
+	return c
+}
+
+func TestSendCardThenUpdate(t *testing.T) {
+	var calls []string
+	var patched map[string]string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t-123" {
+			t.Errorf("missing token on %s", r.URL.Path)
+		}
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case http.MethodPost:
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["msg_type"] != "interactive" || body["receive_id"] != "oc_1" {
+				t.Errorf("unexpected send payload: %v", body)
+			}
+			_, _ = w.Write([]byte(`{"code":0,"data":{"message_id":"om_card"}}`))
+		case http.MethodPatch:
+			_ = json.NewDecoder(r.Body).Decode(&patched)
+			_, _ = w.Write([]byte(`{"code":0,"data":{}}`))
+		}
+	})
+
+	ctx := context.Background()
+	id, err := c.SendCard(ctx, "oc_1", map[string]any{"schema": "2.0"})
+	if err != nil || id != "om_card" {
+		t.Fatalf("send card: id=%q err=%v", id, err)
+	}
+	if err := c.UpdateCard(ctx, id, map[string]any{"schema": "2.0", "header": "done"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[1] != "PATCH /im/v1/messages/om_card" {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+	if patched["content"] != `{"header":"done","schema":"2.0"}` {
+		t.Fatalf("unexpected patch content: %v", patched)
+	}
+}
+
+func TestUpdateCardAPIError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":230001,"msg":"card is not updatable"}`))
+	})
+	if err := c.UpdateCard(context.Background(), "om_card", map[string]any{}); err == nil {
+		t.Fatal("expected api error")
+	}
+}
+
+func TestUserDepartments(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/contact/v3/users/ou_1" || r.URL.Query().Get("user_id_type") != "open_id" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		_, _ = w.Write([]byte(`{"code":0,"data":{"user":{"open_id":"ou_1","department_ids":["od_infra","od_backend"]}}}`))
+	})
+	deps, err := c.UserDepartments(context.Background(), "ou_1")
+	if err != nil || len(deps) != 2 || deps[1] != "od_backend" {
+		t.Fatalf("departments = %v, err = %v", deps, err)
+	}
+}
+
+func TestReplyInThread(t *testing.T) {
+	var body map[string]any
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/im/v1/messages/om_task/reply" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"code":0,"data":{"message_id":"om_reply"}}`))
+	})
+	id, err := c.ReplyCard(context.Background(), "om_task", map[string]any{"schema": "2.0"})
+	if err != nil || id != "om_reply" {
+		t.Fatalf("reply card: id=%q err=%v", id, err)
+	}
+	if body["reply_in_thread"] != true || body["msg_type"] != "interactive" {
+		t.Fatalf("unexpected reply payload: %v", body)
+	}
+}
+
+func TestBotOpenIDAndChatTypeAreCached(t *testing.T) {
+	calls := map[string]int{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Path]++
+		switch r.URL.Path {
+		case "/bot/v3/info":
+			_, _ = w.Write([]byte(`{"code":0,"msg":"ok","bot":{"app_name":"runner","open_id":"ou_bot"}}`))
+		case "/im/v1/chats/oc_topic":
+			_, _ = w.Write([]byte(`{"code":0,"data":{"chat_mode":"topic","name":"dev"}}`))
+		}
+	})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if id, err := c.BotOpenID(ctx); err != nil || id != "ou_bot" {
+			t.Fatalf("bot open_id = %q, err = %v", id, err)
+		}
+		if ct, err := c.ChatType(ctx, "oc_topic"); err != nil || ct != "group" {
+			t.Fatalf("chat type = %q, err = %v", ct, err)
+		}
+	}
+	if calls["/bot/v3/info"] != 1 || calls["/im/v1/chats/oc_topic"] != 1 {
+		t.Fatalf("lookups not cached: %v", calls)
+	}
+}
+
+func TestDownloadResource(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/im/v1/messages/om_1/resources/file_v2_9a1b" || r.URL.Query().Get("type") != "file" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("panic: boom\n"))
+	})
+	var buf bytes.Buffer
+	ctype, err := c.DownloadResource(context.Background(), "om_1", "file_v2_9a1b", "file", &buf, 1<<20)
+	if err != nil || ctype != "text/plain" || buf.String() != "panic: boom\n" {
+		t.Fatalf("download: ctype=%q body=%q err=%v", ctype, buf.String(), err)
+	}
+	if _, err := c.DownloadResource(context.Background(), "om_1", "file_v2_9a1b", "file", &bytes.Buffer{}, 4); err == nil {
+		t.Fatal("resources over the limit must be rejected")
+	}
+}
+
+func TestUploadFileThenReply(t *testing.T) {
+	var uploaded, sent string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/im/v1/files":
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Fatal(err)
+			}
+			f, hdr, err := r.FormFile("file")
+			if err != nil || r.FormValue("file_type") != "stream" || r.FormValue("file_name") != "task-1.log" {
+				t.Fatalf("unexpected upload form: %v %v", r.MultipartForm.Value, err)
+			}
+			b, _ := io.ReadAll(f)
+			uploaded = hdr.Filename + ":" + string(b)
+			_, _ = w.Write([]byte(`{"code":0,"data":{"file_key":"file_v3_1"}}`))
+		case "/im/v1/messages/om_task/reply":
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			sent = body["msg_type"].(string) + ":" + body["content"].(string)
+			_, _ = w.Write([]byte(`{"code":0,"data":{"message_id":"om_file"}}`))
+		}
+	})
+	ctx := context.Background()
+	key, err := c.UploadFile(ctx, "task-1.log", []byte("==> codex\n"))
+	if err != nil || key != "file_v3_1" {
+		t.Fatalf("upload: key=%q err=%v", key, err)
+	}
+	if err := c.ReplyFile(ctx, "om_task", key); err != nil {
+		t.Fatal(err)
+	}
+	if uploaded != "task-1.log:==> codex\n" || sent != `file:{"file_key":"file_v3_1"}` {
+		t.Fatalf("uploaded %q, sent %q", uploaded, sent)
+	}
+}
+
+func TestFetchMessagesPage(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/im/v1/messages":
+			q := r.URL.Query()
+			if q.Get("container_id_type") != "chat" || q.Get("container_id") != "oc_1" || q.Get("start_time") != "1700000000" || q.Get("page_size") != "50" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			if q.Get("page_token") == "" {
+				_, _ = w.Write([]byte(`{"code":0,"data":{"has_more":true,"page_token":"p2","items":[
+					{"message_id":"om_1","chat_id":"oc_1","msg_type":"text","create_time":"1700000001000","sender":{"id":"ou_1","id_type":"open_id","sender_type":"user"},"body":{"content":"{\"text\":\"#repo=aoi fix\"}"}},
+					{"message_id":"om_2","chat_id":"oc_1","msg_type":"text","create_time":"1700000001500","sender":{"id":"cli_bot","id_type":"app_id","sender_type":"app"},"body":{"content":"{\"text\":\"✅ 已接收任务\"}"}},
+					{"message_id":"om_3","chat_id":"oc_1","msg_type":"image","create_time":"1700000002000","sender":{"id":"ou_1","id_type":"open_id","sender_type":"user"},"body":{"content":"{\"image_key\":\"img_1\"}"}}]}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"code":0,"data":{"has_more":false,"page_token":"p3","items":[]}}`))
+		case "/im/v1/chats/oc_1":
+			_, _ = w.Write([]byte(`{"code":0,"data":{"chat_mode":"p2p"}}`))
+		}
+	})
+	ctx := context.Background()
+	msgs, next, err := c.FetchMessages(ctx, "oc_1", time.Unix(1700000000, 0), "")
+	if err != nil || next != "p2" || len(msgs) != 1 || msgs[0].Text != "#repo=aoi fix" || msgs[0].SenderOpenID != "ou_1" || msgs[0].ChatType != "p2p" {
+		t.Fatalf("first page: %+v next=%q err=%v", msgs, next, err)
+	}
+	if _, next, err := c.FetchMessages(ctx, "oc_1", time.Unix(1700000000, 0), next); err != nil || next != "" {
+		t.Fatalf("last page must end paging: next=%q err=%v", next, err)
+	}
+}
+
+func TestListChatsPaginates(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page_token") == "" {
+			_, _ = w.Write([]byte(`{"code":0,"data":{"has_more":true,"page_token":"p2","items":[{"chat_id":"oc_1"},{"chat_id":"oc_2"}]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"data":{"has_more":false,"items":[{"chat_id":"oc_3"}]}}`))
+	})
+	chats, err := c.ListChats(context.Background())
+	if err != nil || len(chats) != 3 || chats[2] != "oc_3" {
+		t.Fatalf("chats = %v, err = %v", chats, err)
+	}
+}
@@ -0,0 +1,174 @@
+package feishu
+
+import (
+	"encoding/json"
+	"strings"
+
+	"feishu-codex-runner/internal/model"
+)
+
+// extractText turns message content into instruction text. Text and rich
+// text (post) messages are understood; other types yield "" and are
+// skipped.
+func extractText(msgType, content string) string {
+	if strings.TrimSpace(content) == "" {
+		return ""
+	}
+	switch msgType {
+	case "post":
+		return postText(content)
+	case "text", "":
+		var v struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal([]byte(content), &v); err != nil {
+			return content
+		}
+		return v.Text
+	}
+	return ""
+}
+
+// postBody is one language of a post message. Received messages carry it
+// directly; sent ones are keyed by locale (zh_cn, en_us, ...).
+type postBody struct {
+	Title   string          `json:"title"`
+	Content [][]postElement `json:"content"`
+}
+
+type postElement struct {
+	Tag      string `json:"tag"`
+	ImageKey string `json:"image_key"`
+	FileKey  string `json:"file_key"`
+	FileName string `json:"file_name"`
+	Text     string `json:"text"`
+	Href     string `json:"href"`
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
+	Language string `json:"language"`
+	Emoji    string `json:"emoji_type"`
+}
+
+func decodePost(content string) (postBody, bool) {
+	var body postBody
+	if err := json.Unmarshal([]byte(content), &body); err != nil {
+		return postBody{}, false
+	}
+	if body.Content != nil {
+		return body, true
+	}
+	var localized map[string]postBody
+	if err := json.Unmarshal([]byte(content), &localized); err != nil {
+		return postBody{}, false
+	}
+	for _, locale := range []string{"zh_cn", "en_us", "ja_jp"} {
+		if b, ok := localized[locale]; ok {
+			return b, true
+		}
+	}
+	for _, b := range localized {
+		return b, true
+	}
+	return postBody{}, false
+}
+
+// postText renders a post as plain text: one line per paragraph, links as
+// "text (url)", mentions as their "@_user_N" placeholder so they can be
+// matched against the message's mentions, and code blocks fenced with ```
+// and kept verbatim.
+func postText(content string) string {
+	body, ok := decodePost(content)
+	if !ok {
+		return ""
+	}
+
+	var lines []string
+	if t := strings.TrimSpace(body.Title); t != "" {
+		lines = append(lines, t)
+	}
+	for _, para := range body.Content {
+		var line strings.Builder
+		for _, el := range para {
+			switch el.Tag {
+			case "text", "md":
+				line.WriteString(el.Text)
+			case "a":
+				switch {
+				case el.Text == "" || el.Text == el.Href:
+					line.WriteString(el.Href)
+				case el.Href == "":
+					line.WriteString(el.Text)
+				default:
+					line.WriteString(el.Text + " (" + el.Href + ")")
+				}
+			case "at":
+				switch {
+				case el.UserID == "all":
+					line.WriteString("@所有人")
+				case strings.HasPrefix(el.UserID, "@_"):
+					line.WriteString(el.UserID)
+				default:
+					line.WriteString("@" + el.UserName)
+				}
+			case "emotion":
+				line.WriteString("[" + el.Emoji + "]")
+			case "hr":
+				line.WriteString("---")
+			case "code_block":
+				if line.Len() > 0 {
+					lines = append(lines, line.String())
+					line.Reset()
+				}
+				code := strings.TrimSuffix(el.Text, "\n")
+				lines = append(lines, "```"+strings.ToLower(el.Language)+"\n"+code+"\n```")
+			}
+		}
+		if line.Len() > 0 || len(para) == 0 {
+			lines = append(lines, line.String())
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// extractAttachments lists the files and images of a message: the resource
+// of an image, file or media message, or those embedded in a post.
+func extractAttachments(msgType, content, messageID string) []model.Attachment {
+	var out []model.Attachment
+	add := func(kind, key, name string) {
+		if key == "" {
+			return
+		}
+		if name == "" {
+			name = key
+		}
+		out = append(out, model.Attachment{MessageID: messageID, Key: key, Kind: kind, Name: name})
+	}
+	switch msgType {
+	case "image":
+		var v struct {
+			ImageKey string `json:"image_key"`
+		}
+		_ = json.Unmarshal([]byte(content), &v)
+		add("image", v.ImageKey, "")
+	case "file", "media":
+		var v struct {
+			FileKey  string `json:"file_key"`
+			FileName string `json:"file_name"`
+		}
+		_ = json.Unmarshal([]byte(content), &v)
+		add("file", v.FileKey, v.FileName)
+	case "post":
+		body, _ := decodePost(content)
+		for _, para := range body.Content {
+			for _, el := range para {
+				switch el.Tag {
+				case "img":
+					add("image", el.ImageKey, "")
+				case "media":
+					add("file", el.FileKey, el.FileName)
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,46 @@
+package feishu
+
+import (
+	"testing"
+
+	"feishu-codex-runner/internal/model"
+)
+
+func TestExtractTextPost(t *testing.T) {
+	got := extractText("post", string(loadFixture(t, "post_content.json")))
+	want := "修复 panic\n" +
+		"@_user_1 #repo=aoi-service 修复下面的 panic，参考 issue 42 (https://github.com/acme/aoi-service/issues/42)\n" +
+		"堆栈：\n" +
+		"```go\npanic: runtime error: invalid memory address\n\ngoroutine 1 [running]:\n    main.handler(0x0)\n\t/app/main.go:42 +0x1d\n```\n" +
+		"修好后请 @_user_2 review [OK]"
+	if got != want {
+		t.Fatalf("post text:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExtractTextLocalizedPostAndOtherTypes(t *testing.T) {
+	post := `{"zh_cn":{"title":"","content":[[{"tag":"text","text":"#repo=aoi 修复 healthz"}]]}}`
+	if got := extractText("post", post); got != "#repo=aoi 修复 healthz" {
+		t.Fatalf("localized post = %q", got)
+	}
+	if got := extractText("text", `{"text":"hello"}`); got != "hello" {
+		t.Fatalf("text = %q", got)
+	}
+	if got := extractText("image", `{"image_key":"img_v2_041b28e3"}`); got != "" {
+		t.Fatalf("image messages carry no instruction, got %q", got)
+	}
+}
+
+func TestExtractAttachments(t *testing.T) {
+	got := extractAttachments("post", string(loadFixture(t, "post_content.json")), "om_1")
+	if len(got) != 1 || got[0] != (model.Attachment{MessageID: "om_1", Key: "img_v2_041b28e3", Kind: "image", Name: "img_v2_041b28e3"}) {
+		t.Fatalf("post attachments = %+v", got)
+	}
+	got = extractAttachments("file", `{"file_key":"file_v2_9a1b","file_name":"panic.log"}`, "om_2")
+	if len(got) != 1 || got[0].Kind != "file" || got[0].Name != "panic.log" || got[0].MessageID != "om_2" {
+		t.Fatalf("file attachments = %+v", got)
+	}
+	if got := extractAttachments("text", `{"text":"hi"}`, "om_3"); len(got) != 0 {
+		t.Fatalf("text messages have no attachments, got %+v", got)
+	}
+}
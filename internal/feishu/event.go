@@ -0,0 +1,142 @@
+package feishu
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"feishu-codex-runner/internal/model"
+)
+
+const (
+	eventMessageReceive = "im.message.receive_v1"
+	eventCardAction     = "card.action.trigger"
+)
+
+// eventEnvelope is the schema 2.0 wrapper Feishu uses for every pushed event,
+// whether it arrives over the long connection or an HTTP callback.
+type eventEnvelope struct {
+	Schema string `json:"schema"`
+	Header struct {
+		EventID    string `json:"event_id"`
+		EventType  string `json:"event_type"`
+		CreateTime string `json:"create_time"`
+		Token      string `json:"token"`
+		AppID      string `json:"app_id"`
+	} `json:"header"`
+	Event json.RawMessage `json:"event"`
+}
+
+type messageReceiveEvent struct {
+	Sender struct {
+		SenderID struct {
+			OpenID string `json:"open_id"`
+		} `json:"sender_id"`
+		SenderType string `json:"sender_type"`
+	} `json:"sender"`
+	Message struct {
+		MessageID   string `json:"message_id"`
+		ParentID    string `json:"parent_id"`
+		ChatID      string `json:"chat_id"`
+		ChatType    string `json:"chat_type"`
+		MessageType string `json:"message_type"`
+		Content     string `json:"content"`
+		CreateTime  string `json:"create_time"`
+		Mentions    []struct {
+			Key string `json:"key"`
+			ID  struct {
+				OpenID string `json:"open_id"`
+			} `json:"id"`
+			Name string `json:"name"`
+		} `json:"mentions"`
+	} `json:"message"`
+}
+
+// cardActionEvent is sent when a user clicks a callback button on a card.
+// Buttons rendered by the runner carry {"action": ..., "task_id": ...}.
+type cardActionEvent struct {
+	Operator struct {
+		OpenID string `json:"open_id"`
+	} `json:"operator"`
+	Action struct {
+		Value map[string]any `json:"value"`
+	} `json:"action"`
+	Context struct {
+		OpenMessageID string `json:"open_message_id"`
+		OpenChatID    string `json:"open_chat_id"`
+	} `json:"context"`
+}
+
+// parseEvent converts pushed events into a Message. Card button clicks become
+// the equivalent chat command (e.g. "/retry <task_id>") so they share the
+// command path. ok is false for other event types and for messages without
+// usable text.
+func parseEvent(data []byte) (msg model.Message, ok bool, err error) {
+	var env eventEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return model.Message{}, false, fmt.Errorf("decode event: %w", err)
+	}
+	switch env.Header.EventType {
+	case eventMessageReceive:
+		return parseMessageReceive(env)
+	case eventCardAction:
+		return parseCardAction(env)
+	}
+	return model.Message{}, false, nil
+}
+
+func parseCardAction(env eventEnvelope) (model.Message, bool, error) {
+	var ev cardActionEvent
+	if err := json.Unmarshal(env.Event, &ev); err != nil {
+		return model.Message{}, false, fmt.Errorf("decode %s: %w", eventCardAction, err)
+	}
+	action, _ := ev.Action.Value["action"].(string)
+	taskID, _ := ev.Action.Value["task_id"].(string)
+	if action == "" || taskID == "" {
+		return model.Message{}, false, nil
+	}
+	return model.Message{
+		MessageID:    "card_" + env.Header.EventID,
+		ChatID:       ev.Context.OpenChatID,
+		SenderOpenID: ev.Operator.OpenID,
+		Text:         "/" + action + " " + taskID,
+		CreateTime:   parseCreateTime(env.Header.CreateTime),
+	}, true, nil
+}
+
+func parseMessageReceive(env eventEnvelope) (model.Message, bool, error) {
+	var ev messageReceiveEvent
+	if err := json.Unmarshal(env.Event, &ev); err != nil {
+		return model.Message{}, false, fmt.Errorf("decode %s: %w", eventMessageReceive, err)
+	}
+	txt := extractText(ev.Message.MessageType, ev.Message.Content)
+	if strings.TrimSpace(txt) == "" {
+		return model.Message{}, false, nil
+	}
+	msg := model.Message{
+		MessageID:    ev.Message.MessageID,
+		ChatID:       ev.Message.ChatID,
+		SenderOpenID: ev.Sender.SenderID.OpenID,
+		Text:         txt,
+		CreateTime:   parseCreateTime(ev.Message.CreateTime),
+		ChatType:     ev.Message.ChatType,
+		ParentID:     ev.Message.ParentID,
+		Attachments:  extractAttachments(ev.Message.MessageType, ev.Message.Content, ev.Message.MessageID),
+	}
+	for _, m := range ev.Message.Mentions {
+		msg.Mentions = append(msg.Mentions, model.Mention{Key: m.Key, OpenID: m.ID.OpenID, Name: m.Name})
+	}
+	return msg, true, nil
+}
+
+// parseCreateTime accepts the millisecond (or second) timestamps Feishu
+// returns as strings.
+func parseCreateTime(v string) time.Time {
+	ms, _ := strconv.ParseInt(v, 10, 64)
+	if ms > 1e12 {
+		ms = ms / 1000
+	}
+	return time.Unix(ms, 0)
+}
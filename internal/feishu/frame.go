@@ -0,0 +1,185 @@
+package feishu
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	frameMethodControl int32 = 0
+	frameMethodData    int32 = 1
+)
+
+// frame mirrors the pbbp2.Frame protobuf message exchanged over the
+// long-connection gateway. Only the handful of fields the runner needs are
+// encoded, so the protobuf runtime is not pulled in for a single message type.
+type frame struct {
+	SeqID           uint64
+	LogID           uint64
+	Service         int32
+	Method          int32
+	Headers         []frameHeader
+	PayloadEncoding string
+	PayloadType     string
+	Payload         []byte
+	LogIDNew        string
+}
+
+type frameHeader struct {
+	Key   string
+	Value string
+}
+
+func (f frame) header(key string) string {
+	for _, h := range f.Headers {
+		if h.Key == key {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func (f *frame) setHeader(key, value string) {
+	for i, h := range f.Headers {
+		if h.Key == key {
+			f.Headers[i].Value = value
+			return
+		}
+	}
+	f.Headers = append(f.Headers, frameHeader{Key: key, Value: value})
+}
+
+func (f frame) marshal() []byte {
+	var b []byte
+	// seq_id, log_id, service and method are proto2 required fields, so they
+	// are always written even when zero.
+	b = appendVarintField(b, 1, f.SeqID)
+	b = appendVarintField(b, 2, f.LogID)
+	b = appendVarintField(b, 3, uint64(uint32(f.Service)))
+	b = appendVarintField(b, 4, uint64(uint32(f.Method)))
+	for _, h := range f.Headers {
+		var hb []byte
+		hb = appendBytesField(hb, 1, []byte(h.Key))
+		hb = appendBytesField(hb, 2, []byte(h.Value))
+		b = appendBytesField(b, 5, hb)
+	}
+	if f.PayloadEncoding != "" {
+		b = appendBytesField(b, 6, []byte(f.PayloadEncoding))
+	}
+	if f.PayloadType != "" {
+		b = appendBytesField(b, 7, []byte(f.PayloadType))
+	}
+	if len(f.Payload) > 0 {
+		b = appendBytesField(b, 8, f.Payload)
+	}
+	if f.LogIDNew != "" {
+		b = appendBytesField(b, 9, []byte(f.LogIDNew))
+	}
+	return b
+}
+
+func unmarshalFrame(b []byte) (frame, error) {
+	var f frame
+	err := walkFields(b, func(num int, varint uint64, data []byte) error {
+		switch num {
+		case 1:
+			f.SeqID = varint
+		case 2:
+			f.LogID = varint
+		case 3:
+			f.Service = int32(varint)
+		case 4:
+			f.Method = int32(varint)
+		case 5:
+			var h frameHeader
+			err := walkFields(data, func(num int, _ uint64, data []byte) error {
+				switch num {
+				case 1:
+					h.Key = string(data)
+				case 2:
+					h.Value = string(data)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("header: %w", err)
+			}
+			f.Headers = append(f.Headers, h)
+		case 6:
+			f.PayloadEncoding = string(data)
+		case 7:
+			f.PayloadType = string(data)
+		case 8:
+			f.Payload = append([]byte(nil), data...)
+		case 9:
+			f.LogIDNew = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return frame{}, fmt.Errorf("decode frame: %w", err)
+	}
+	return f, nil
+}
+
+var errTruncated = errors.New("truncated protobuf data")
+
+// walkFields calls fn for every field in a protobuf message. Varint fields
+// pass their value, length-delimited fields pass their bytes; fixed-width
+// fields are skipped because pbbp2 does not use them.
+func walkFields(b []byte, fn func(num int, varint uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		num, wire := int(key>>3), key&7
+		switch wire {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+			if err := fn(num, v, nil); err != nil {
+				return err
+			}
+		case 1:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errTruncated
+			}
+			data := b[n : n+int(l)]
+			b = b[n+int(l):]
+			if err := fn(num, 0, data); err != nil {
+				return err
+			}
+		case 5:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			b = b[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+	}
+	return nil
+}
+
+func appendVarintField(b []byte, num int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytesField(b []byte, num int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
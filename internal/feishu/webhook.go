@@ -0,0 +1,184 @@
+package feishu
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"feishu-codex-runner/internal/model"
+)
+
+const maxWebhookBody = 1 << 20
+
+// maxRequestAge bounds how far X-Lark-Request-Timestamp of a signed callback
+// may be from now, so a captured request cannot be replayed later.
+const maxRequestAge = 5 * time.Minute
+
+// WebhookHandler receives event callbacks pushed by Feishu over HTTP. It
+// answers the URL verification challenge, checks the request signature and
+// verification token, decrypts encrypted payloads and passes message events
+// to handle. handle runs before the response is written, so it must return
+// quickly; Feishu retries callbacks that take longer than a few seconds.
+type WebhookHandler struct {
+	verificationToken string
+	encryptKey        string
+	handle            func(context.Context, model.Message)
+}
+
+func NewWebhookHandler(verificationToken, encryptKey string, handle func(context.Context, model.Message)) *WebhookHandler {
+	return &WebhookHandler{verificationToken: verificationToken, encryptKey: encryptKey, handle: handle}
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "read body", http.StatusBadRequest)
+		return
+	}
+	signature := r.Header.Get("X-Lark-Signature")
+	if signature != "" && h.encryptKey != "" {
+		want := signEvent(r.Header.Get("X-Lark-Request-Timestamp"), r.Header.Get("X-Lark-Request-Nonce"), h.encryptKey, body)
+		if subtle.ConstantTimeCompare([]byte(signature), []byte(want)) != 1 {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if !fresh(r.Header.Get("X-Lark-Request-Timestamp"), time.Now()) {
+			http.Error(w, "stale request", http.StatusUnauthorized)
+			return
+		}
+	}
+	plain, err := h.decode(body)
+	if err != nil {
+		log.Printf("webhook: %v", err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	var probe struct {
+		Type      string `json:"type"`
+		Token     string `json:"token"`
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal(plain, &probe); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if probe.Type == "url_verification" {
+		if !h.tokenOK(probe.Token) {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, map[string]string{"challenge": probe.Challenge})
+		return
+	}
+	// Event pushes must be signed once an encrypt key is configured; only the
+	// URL verification request above is sent without a signature.
+	if signature == "" && h.encryptKey != "" {
+		http.Error(w, "missing signature", http.StatusUnauthorized)
+		return
+	}
+
+	var env eventEnvelope
+	if err := json.Unmarshal(plain, &env); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if !h.tokenOK(env.Header.Token) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	msg, ok, err := parseEvent(plain)
+	if err != nil {
+		log.Printf("webhook event: %v", err)
+	}
+	if ok {
+		h.handle(r.Context(), msg)
+	}
+	writeJSON(w, map[string]any{})
+}
+
+// decode unwraps {"encrypt": "..."} bodies; plain bodies are returned as is.
+func (h *WebhookHandler) decode(body []byte) ([]byte, error) {
+	var wrapped struct {
+		Encrypt string `json:"encrypt"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return nil, fmt.Errorf("decode body: %w", err)
+	}
+	if wrapped.Encrypt == "" {
+		return body, nil
+	}
+	if h.encryptKey == "" {
+		return nil, errors.New("received encrypted event but no encrypt key is configured")
+	}
+	return decryptEvent(wrapped.Encrypt, h.encryptKey)
+}
+
+func (h *WebhookHandler) tokenOK(token string) bool {
+	return h.verificationToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.verificationToken)) == 1
+}
+
+// fresh reports whether the Unix timestamp ts is within maxRequestAge of now.
+func fresh(ts string, now time.Time) bool {
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	d := now.Sub(time.Unix(sec, 0))
+	return d <= maxRequestAge && d >= -maxRequestAge
+}
+
+// signEvent computes X-Lark-Signature: sha256(timestamp + nonce + key + body).
+func signEvent(timestamp, nonce, encryptKey string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(timestamp + nonce + encryptKey))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// decryptEvent reverses Feishu's AES-256-CBC event encryption. The key is the
+// SHA-256 of the encrypt key and the IV is the first block of the ciphertext.
+func decryptEvent(encrypted, encryptKey string) ([]byte, error) {
+	buf, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("decode encrypted event: %w", err)
+	}
+	if len(buf) < 2*aes.BlockSize || len(buf)%aes.BlockSize != 0 {
+		return nil, errors.New("encrypted event has invalid length")
+	}
+	key := sha256.Sum256([]byte(encryptKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	iv, data := buf[:aes.BlockSize], buf[aes.BlockSize:]
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(out[len(out)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errors.New("decrypt event: bad padding (wrong encrypt key?)")
+	}
+	return out[:len(out)-pad], nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
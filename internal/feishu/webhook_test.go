@@ -0,0 +1,175 @@
+package feishu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"feishu-codex-runner/internal/model"
+)
+
+const (
+	testVerifyToken = "verify-token"
+	testEncryptKey  = "test-encrypt-key"
+)
+
+func loadFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func newWebhookServer(t *testing.T, encryptKey string) (*httptest.Server, *[]model.Message) {
+	t.Helper()
+	var got []model.Message
+	h := NewWebhookHandler(testVerifyToken, encryptKey, func(_ context.Context, msg model.Message) {
+		got = append(got, msg)
+	})
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func postEvent(t *testing.T, url string, body []byte, signKey string) *http.Response {
+	t.Helper()
+	return postEventAt(t, url, body, signKey, time.Now())
+}
+
+func postEventAt(t *testing.T, url string, body []byte, signKey string, at time.Time) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if signKey != "" {
+		ts := strconv.FormatInt(at.Unix(), 10)
+		req.Header.Set("X-Lark-Request-Timestamp", ts)
+		req.Header.Set("X-Lark-Request-Nonce", "nonce-1")
+		req.Header.Set("X-Lark-Signature", signEvent(ts, "nonce-1", signKey, body))
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestWebhookURLVerification(t *testing.T) {
+	srv, _ := newWebhookServer(t, "")
+	res := postEvent(t, srv.URL, loadFixture(t, "url_verification.json"), "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status=%d", res.StatusCode)
+	}
+	var out map[string]string
+	_ = json.NewDecoder(res.Body).Decode(&out)
+	if out["challenge"] != "ajls384kdjx98XX" {
+		t.Fatalf("unexpected challenge response: %v", out)
+	}
+}
+
+func TestWebhookPlainMessageEvent(t *testing.T) {
+	srv, got := newWebhookServer(t, "")
+	res := postEvent(t, srv.URL, loadFixture(t, "message_receive.json"), "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status=%d", res.StatusCode)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("expected one message, got %d", len(*got))
+	}
+	m := (*got)[0]
+	if m.MessageID != "om_5ce6d572455d361153b7cb51da133945" || m.SenderOpenID != "ou_84aad35d084aa403a838cf73ee18467" || m.Text != "#repo=aoi-service 修复 healthz" {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+}
+
+func TestWebhookGroupMessageMentions(t *testing.T) {
+	srv, got := newWebhookServer(t, "")
+	postEvent(t, srv.URL, loadFixture(t, "message_receive_group.json"), "")
+	if len(*got) != 1 {
+		t.Fatalf("expected one message, got %d", len(*got))
+	}
+	m := (*got)[0]
+	if !m.Group() || len(m.Mentions) != 2 || m.Mentions[0].OpenID != "ou_bot" || m.Mentions[1].Key != "@_user_2" || m.Mentions[1].Name != "Lead" {
+		t.Fatalf("unexpected group message: %+v", m)
+	}
+}
+
+func TestWebhookCardActionBecomesCommand(t *testing.T) {
+	srv, got := newWebhookServer(t, "")
+	res := postEvent(t, srv.URL, loadFixture(t, "card_action.json"), "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status=%d", res.StatusCode)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("expected one message, got %d", len(*got))
+	}
+	m := (*got)[0]
+	if m.Text != "/retry 0a1b2c3d4e5f" || m.SenderOpenID != "ou_84aad35d084aa403a838cf73ee18467" || m.ChatID != "oc_5ce6d572455d361153b7xx51da133945" {
+		t.Fatalf("unexpected message: %+v", m)
+	}
+	if m.MessageID != "card_f7984f25108f8137722bb63cee927e66" {
+		t.Fatalf("card clicks need a distinct message id, got %s", m.MessageID)
+	}
+}
+
+func TestWebhookEncryptedSignedEvent(t *testing.T) {
+	srv, got := newWebhookServer(t, testEncryptKey)
+	body := loadFixture(t, "message_receive_encrypted.json")
+	res := postEvent(t, srv.URL, body, testEncryptKey)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status=%d", res.StatusCode)
+	}
+	if len(*got) != 1 || (*got)[0].ChatID != "oc_5ce6d572455d361153b7xx51da133945" {
+		t.Fatalf("unexpected messages: %+v", *got)
+	}
+}
+
+func TestWebhookRejectsBadSignature(t *testing.T) {
+	srv, got := newWebhookServer(t, testEncryptKey)
+	body := loadFixture(t, "message_receive_encrypted.json")
+	if res := postEvent(t, srv.URL, body, "wrong-key"); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("bad signature: status=%d", res.StatusCode)
+	}
+	if res := postEvent(t, srv.URL, body, ""); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("missing signature: status=%d", res.StatusCode)
+	}
+	if len(*got) != 0 {
+		t.Fatalf("rejected events must not be handled: %+v", *got)
+	}
+}
+
+func TestWebhookRejectsReplayedEvent(t *testing.T) {
+	srv, got := newWebhookServer(t, testEncryptKey)
+	body := loadFixture(t, "message_receive_encrypted.json")
+	for _, at := range []time.Time{time.Now().Add(-10 * time.Minute), time.Now().Add(10 * time.Minute)} {
+		if res := postEventAt(t, srv.URL, body, testEncryptKey, at); res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("signed at %s: status=%d", at, res.StatusCode)
+		}
+	}
+	if res := postEventAt(t, srv.URL, body, testEncryptKey, time.Now().Add(-time.Minute)); res.StatusCode != http.StatusOK {
+		t.Fatalf("recent event: status=%d", res.StatusCode)
+	}
+	if len(*got) != 1 {
+		t.Fatalf("only the recent event should be handled: %+v", *got)
+	}
+}
+
+func TestWebhookRejectsWrongToken(t *testing.T) {
+	srv, got := newWebhookServer(t, "")
+	body := bytes.Replace(loadFixture(t, "message_receive.json"), []byte(testVerifyToken), []byte("other"), 1)
+	if res := postEvent(t, srv.URL, body, ""); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status=%d", res.StatusCode)
+	}
+	if len(*got) != 0 {
+		t.Fatalf("unexpected messages: %+v", *got)
+	}
+}
@@ -0,0 +1,352 @@
+package feishu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"feishu-codex-runner/internal/model"
+)
+
+const wsEndpointURL = "https://open.feishu.cn/callback/ws/endpoint"
+
+// WSClient receives events over Feishu's long-connection (WebSocket) gateway,
+// so the runner gets messages pushed instead of polling for them.
+type WSClient struct {
+	appID     string
+	appSecret string
+	http      *http.Client
+	dialer    *websocket.Dialer
+	endpoint  string
+
+	// Defaults used until the gateway sends its own client config; the
+	// gateway refreshes them on every pong, so access goes through mu.
+	mu                sync.Mutex
+	pingInterval      time.Duration
+	reconnectInterval time.Duration
+	reconnectNonce    time.Duration
+	reconnectCount    int
+}
+
+// clientConfig is returned by the endpoint API and refreshed on every pong.
+// Intervals are in seconds; a negative ReconnectCount means retry forever.
+type clientConfig struct {
+	ReconnectCount    int `json:"ReconnectCount"`
+	ReconnectInterval int `json:"ReconnectInterval"`
+	ReconnectNonce    int `json:"ReconnectNonce"`
+	PingInterval      int `json:"PingInterval"`
+}
+
+func NewWSClient(appID, appSecret string) *WSClient {
+	return &WSClient{
+		appID:             appID,
+		appSecret:         appSecret,
+		http:              &http.Client{Timeout: 20 * time.Second},
+		dialer:            &websocket.Dialer{HandshakeTimeout: 20 * time.Second},
+		endpoint:          wsEndpointURL,
+		pingInterval:      2 * time.Minute,
+		reconnectInterval: 2 * time.Minute,
+		reconnectNonce:    30 * time.Second,
+		reconnectCount:    -1,
+	}
+}
+
+// Run keeps a long connection open and calls handle for every received
+// message until ctx is cancelled. Dropped connections are re-established
+// following the gateway's reconnect policy.
+func (c *WSClient) Run(ctx context.Context, handle func(context.Context, model.Message)) error {
+	failures := 0
+	for {
+		connected, err := c.connectAndServe(ctx, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			failures = 0
+		}
+		failures++
+		c.mu.Lock()
+		limit, wait, nonce := c.reconnectCount, c.reconnectInterval, c.reconnectNonce
+		c.mu.Unlock()
+		if limit >= 0 && failures > limit {
+			return fmt.Errorf("long connection: giving up after %d attempts: %w", failures, err)
+		}
+		if nonce > 0 {
+			wait += time.Duration(rand.Int63n(int64(nonce)))
+		}
+		log.Printf("long connection lost: %v; reconnecting in %s", err, wait.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *WSClient) connectAndServe(ctx context.Context, handle func(context.Context, model.Message)) (bool, error) {
+	connURL, err := c.fetchEndpoint(ctx)
+	if err != nil {
+		return false, err
+	}
+	u, err := url.Parse(connURL)
+	if err != nil {
+		return false, fmt.Errorf("parse endpoint url: %w", err)
+	}
+	serviceID, _ := strconv.ParseInt(u.Query().Get("service_id"), 10, 32)
+
+	conn, _, err := c.dialer.DialContext(ctx, connURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("dial long connection: %w", err)
+	}
+	log.Printf("long connection established")
+	s := &wsSession{
+		client:  c,
+		conn:    conn,
+		service: int32(serviceID),
+		parts:   map[string]*partialEvent{},
+		done:    make(chan struct{}),
+	}
+	defer s.close()
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.close()
+		case <-s.done:
+		}
+	}()
+	go s.pingLoop()
+	return true, s.readLoop(ctx, handle)
+}
+
+func (c *WSClient) fetchEndpoint(ctx context.Context) (string, error) {
+	data, _ := json.Marshal(map[string]string{"AppID": c.appID, "AppSecret": c.appSecret})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("locale", "zh")
+	res, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("get ws endpoint: %w", err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode >= 300 {
+		return "", fmt.Errorf("get ws endpoint status=%d body=%s", res.StatusCode, string(body))
+	}
+	var r struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Data struct {
+			URL          string        `json:"URL"`
+			ClientConfig *clientConfig `json:"ClientConfig"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return "", fmt.Errorf("decode ws endpoint: %w", err)
+	}
+	if r.Code != 0 {
+		return "", fmt.Errorf("get ws endpoint api error code=%d msg=%s", r.Code, r.Msg)
+	}
+	if r.Data.URL == "" {
+		return "", errors.New("get ws endpoint: empty url")
+	}
+	if r.Data.ClientConfig != nil {
+		c.applyConfig(*r.Data.ClientConfig)
+	}
+	return r.Data.URL, nil
+}
+
+func (c *WSClient) applyConfig(cc clientConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cc.PingInterval > 0 {
+		c.pingInterval = time.Duration(cc.PingInterval) * time.Second
+	}
+	if cc.ReconnectInterval > 0 {
+		c.reconnectInterval = time.Duration(cc.ReconnectInterval) * time.Second
+	}
+	if cc.ReconnectNonce > 0 {
+		c.reconnectNonce = time.Duration(cc.ReconnectNonce) * time.Second
+	}
+	if cc.ReconnectCount != 0 {
+		c.reconnectCount = cc.ReconnectCount
+	}
+}
+
+func (c *WSClient) currentPingInterval() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pingInterval
+}
+
+// partialTTL is how long the frames of a split event are kept waiting for
+// the rest; incomplete events are dropped on the next ping after that.
+const partialTTL = time.Minute
+
+type partialEvent struct {
+	frames [][]byte
+	first  time.Time
+}
+
+type wsSession struct {
+	client  *WSClient
+	conn    *websocket.Conn
+	service int32
+
+	writeMu sync.Mutex
+	// parts buffers events the gateway splits across several frames.
+	partsMu sync.Mutex
+	parts   map[string]*partialEvent
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (s *wsSession) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		_ = s.conn.Close()
+	})
+}
+
+func (s *wsSession) write(f frame) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return s.conn.WriteMessage(websocket.BinaryMessage, f.marshal())
+}
+
+func (s *wsSession) pingLoop() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.client.currentPingInterval()):
+		}
+		s.evictParts(time.Now())
+		ping := frame{Service: s.service, Method: frameMethodControl}
+		ping.setHeader("type", "ping")
+		if err := s.write(ping); err != nil {
+			log.Printf("long connection ping: %v", err)
+			s.close()
+			return
+		}
+	}
+}
+
+func (s *wsSession) readLoop(ctx context.Context, handle func(context.Context, model.Message)) error {
+	for {
+		mt, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("read long connection: %w", err)
+		}
+		if mt != websocket.BinaryMessage {
+			continue
+		}
+		f, err := unmarshalFrame(data)
+		if err != nil {
+			log.Printf("long connection: %v", err)
+			continue
+		}
+		switch f.Method {
+		case frameMethodControl:
+			s.handleControl(f)
+		case frameMethodData:
+			s.handleData(ctx, f, handle)
+		}
+	}
+}
+
+func (s *wsSession) handleControl(f frame) {
+	if f.header("type") != "pong" || len(f.Payload) == 0 {
+		return
+	}
+	var cc clientConfig
+	if err := json.Unmarshal(f.Payload, &cc); err == nil {
+		s.client.applyConfig(cc)
+	}
+}
+
+func (s *wsSession) handleData(ctx context.Context, f frame, handle func(context.Context, model.Message)) {
+	start := time.Now()
+	payload, complete := s.assemble(f)
+	if !complete {
+		return
+	}
+	if t := f.header("type"); t != "event" && t != "card" {
+		s.ack(f, start)
+		return
+	}
+	msg, ok, err := parseEvent(payload)
+	// Acknowledge before handling: the gateway redelivers events that are not
+	// acknowledged within a few seconds, and handling may take much longer.
+	s.ack(f, start)
+	if err != nil {
+		log.Printf("long connection event: %v", err)
+		return
+	}
+	if ok {
+		handle(ctx, msg)
+	}
+}
+
+// assemble joins multi-frame payloads, identified by the message_id header
+// and ordered by seq out of sum.
+func (s *wsSession) assemble(f frame) ([]byte, bool) {
+	sum, _ := strconv.Atoi(f.header("sum"))
+	if sum <= 1 {
+		return f.Payload, true
+	}
+	seq, _ := strconv.Atoi(f.header("seq"))
+	id := f.header("message_id")
+	s.partsMu.Lock()
+	defer s.partsMu.Unlock()
+	pe, ok := s.parts[id]
+	if !ok {
+		pe = &partialEvent{frames: make([][]byte, sum), first: time.Now()}
+		s.parts[id] = pe
+	}
+	if seq >= 0 && seq < len(pe.frames) {
+		pe.frames[seq] = f.Payload
+	}
+	for _, p := range pe.frames {
+		if p == nil {
+			return nil, false
+		}
+	}
+	delete(s.parts, id)
+	return bytes.Join(pe.frames, nil), true
+}
+
+// evictParts drops split events whose first frame arrived more than
+// partialTTL before now.
+func (s *wsSession) evictParts(now time.Time) {
+	s.partsMu.Lock()
+	defer s.partsMu.Unlock()
+	for id, pe := range s.parts {
+		if now.Sub(pe.first) > partialTTL {
+			log.Printf("long connection: dropping incomplete event %s", id)
+			delete(s.parts, id)
+		}
+	}
+}
+
+func (s *wsSession) ack(f frame, start time.Time) {
+	resp, _ := json.Marshal(map[string]any{"code": http.StatusOK})
+	f.Payload = resp
+	f.setHeader("biz_rt", strconv.FormatInt(time.Since(start).Milliseconds(), 10))
+	if err := s.write(f); err != nil {
+		log.Printf("long connection ack: %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package feishu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"feishu-codex-runner/internal/model"
+)
+
+func messageEventJSON(messageID, text string) []byte {
+	content, _ := json.Marshal(map[string]string{"text": text})
+	ev := map[string]any{
+		"schema": "2.0",
+		"header": map[string]any{"event_id": "ev_" + messageID, "event_type": eventMessageReceive},
+		"event": map[string]any{
+			"sender": map[string]any{"sender_id": map[string]string{"open_id": "ou_1"}},
+			"message": map[string]any{
+				"message_id":   messageID,
+				"chat_id":      "oc_1",
+				"chat_type":    "p2p",
+				"message_type": "text",
+				"content":      string(content),
+				"create_time":  "1700000000000",
+			},
+		},
+	}
+	b, _ := json.Marshal(ev)
+	return b
+}
+
+func eventFrames(messageID string, payload []byte, parts int) []frame {
+	size := (len(payload) + parts - 1) / parts
+	var out []frame
+	for i := 0; i < parts; i++ {
+		end := (i + 1) * size
+		if end > len(payload) {
+			end = len(payload)
+		}
+		f := frame{SeqID: uint64(i), Service: 7, Method: frameMethodData, Payload: payload[i*size : end]}
+		f.setHeader("type", "event")
+		f.setHeader("message_id", messageID)
+		f.setHeader("sum", fmt.Sprint(parts))
+		f.setHeader("seq", fmt.Sprint(i))
+		out = append(out, f)
+	}
+	return out
+}
+
+// fakeGateway serves the endpoint API and the WebSocket gateway. Every
+// connection pushes the next scripted event and then drops.
+type fakeGateway struct {
+	t      *testing.T
+	srv    *httptest.Server
+	events [][]frame
+
+	mu    sync.Mutex
+	conns int
+	acks  []frame
+}
+
+func newFakeGateway(t *testing.T, events ...[]frame) *fakeGateway {
+	g := &fakeGateway{t: t, events: events}
+	up := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback/ws/endpoint", func(w http.ResponseWriter, r *http.Request) {
+		wsURL := "ws" + strings.TrimPrefix(g.srv.URL, "http") + "/ws?device_id=d1&service_id=7"
+		fmt.Fprintf(w, `{"code":0,"msg":"ok","data":{"URL":%q}}`, wsURL)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+		g.mu.Lock()
+		idx := g.conns
+		g.conns++
+		g.mu.Unlock()
+		if idx >= len(g.events) {
+			// Keep the last connection open until the client goes away.
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+		for _, f := range g.events[idx] {
+			if err := conn.WriteMessage(websocket.BinaryMessage, f.marshal()); err != nil {
+				t.Errorf("write frame: %v", err)
+				return
+			}
+		}
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Errorf("read ack: %v", err)
+			return
+		}
+		ack, err := unmarshalFrame(data)
+		if err != nil {
+			t.Errorf("decode ack: %v", err)
+			return
+		}
+		g.mu.Lock()
+		g.acks = append(g.acks, ack)
+		g.mu.Unlock()
+	})
+	g.srv = httptest.NewServer(mux)
+	t.Cleanup(g.srv.Close)
+	return g
+}
+
+func TestWSClientReceivesEventsAndReconnects(t *testing.T) {
+	g := newFakeGateway(t,
+		eventFrames("om_1", messageEventJSON("om_1", "#repo=aoi first"), 2),
+		eventFrames("om_2", messageEventJSON("om_2", "#repo=aoi second"), 1),
+	)
+	c := NewWSClient("cli_x", "secret")
+	c.endpoint = g.srv.URL + "/callback/ws/endpoint"
+	c.reconnectInterval = 10 * time.Millisecond
+	c.reconnectNonce = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got := make(chan model.Message, 2)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Run(ctx, func(_ context.Context, msg model.Message) { got <- msg })
+	}()
+
+	var msgs []model.Message
+	for len(msgs) < 2 {
+		select {
+		case m := <-got:
+			msgs = append(msgs, m)
+		case <-ctx.Done():
+			t.Fatalf("timed out, received %d messages", len(msgs))
+		}
+	}
+	// The gateway records the second ack asynchronously; give it a moment.
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		g.mu.Lock()
+		n := len(g.acks)
+		g.mu.Unlock()
+		if n >= 2 {
+			break
+		}
+	}
+	cancel()
+	<-errCh
+
+	if msgs[0].MessageID != "om_1" || msgs[0].Text != "#repo=aoi first" || msgs[0].SenderOpenID != "ou_1" {
+		t.Fatalf("unexpected first message: %+v", msgs[0])
+	}
+	if msgs[1].MessageID != "om_2" || msgs[1].ChatID != "oc_1" {
+		t.Fatalf("unexpected second message: %+v", msgs[1])
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conns < 2 {
+		t.Fatalf("expected a reconnect, got %d connections", g.conns)
+	}
+	if len(g.acks) != 2 || !strings.Contains(string(g.acks[0].Payload), `"code":200`) {
+		t.Fatalf("unexpected acks: %+v", g.acks)
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	in := frame{SeqID: 3, LogID: 9, Service: 7, Method: frameMethodData, Payload: []byte("hi"), PayloadType: "json"}
+	in.setHeader("type", "event")
+	out, err := unmarshalFrame(in.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.SeqID != 3 || out.Service != 7 || out.header("type") != "event" || string(out.Payload) != "hi" {
+		t.Fatalf("unexpected frame: %+v", out)
+	}
+}
+
+func TestAssembleDropsIncompleteEvents(t *testing.T) {
+	s := &wsSession{parts: map[string]*partialEvent{}}
+	part := func(id string, seq int) frame {
+		f := frame{Method: frameMethodData, Payload: []byte(fmt.Sprint(seq))}
+		f.setHeader("message_id", id)
+		f.setHeader("sum", "2")
+		f.setHeader("seq", fmt.Sprint(seq))
+		return f
+	}
+	if _, complete := s.assemble(part("m1", 0)); complete {
+		t.Fatal("one of two frames must not complete the event")
+	}
+	s.evictParts(time.Now())
+	if len(s.parts) != 1 {
+		t.Fatal("a fresh partial event must be kept")
+	}
+	s.evictParts(time.Now().Add(partialTTL + time.Second))
+	if len(s.parts) != 0 {
+		t.Fatalf("stale partial event should be dropped, %d left", len(s.parts))
+	}
+
+	s.assemble(part("m2", 1))
+	if payload, complete := s.assemble(part("m2", 0)); !complete || string(payload) != "01" || len(s.parts) != 0 {
+		t.Fatalf("payload %q complete=%v parts=%d", payload, complete, len(s.parts))
+	}
+}
@@ -0,0 +1,380 @@
+// Package gotest summarises `go test` output: per-package results, test
+// counts and the log lines of each failing test.
+package gotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxFailureLines caps the log lines kept per failing test or build.
+const maxFailureLines = 30
+
+// Report is the parsed result of one `go test` run.
+type Report struct {
+	Packages []Package
+	Passed   int
+	Failed   int
+	Skipped  int
+	Failures []Failure
+	// Output is the run's output in the usual non-verbose form: build errors,
+	// failing tests and the per-package result lines. For plain output it is
+	// the output unchanged.
+	Output string
+}
+
+// Package is the result of one tested package.
+type Package struct {
+	Name        string
+	Failed      bool
+	BuildFailed bool
+}
+
+// Failure is a failing test, or a package that failed to build or failed
+// outside of any test (Test == "").
+type Failure struct {
+	Package string
+	Test    string
+	Build   bool
+	Log     []string
+}
+
+// Name is the failing test's name, or a description of a package failure.
+func (f Failure) Name() string {
+	switch {
+	case f.Build:
+		return "[build failed]"
+	case f.Test == "":
+		return "[package failed]"
+	}
+	return f.Test
+}
+
+// String renders the failure's heading and log lines.
+func (f Failure) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s)", f.Name(), f.Package)
+	for _, l := range f.Log {
+		b.WriteString("\n    " + l)
+	}
+	return b.String()
+}
+
+// Summary is a one line overview such as
+// "3 passed, 2 failed: TestAdd (pkg/calc), TestTable/two (pkg/calc)".
+func (r *Report) Summary() string {
+	counts := fmt.Sprintf("%d passed, %d failed", r.Passed, r.Failed)
+	if r.Skipped > 0 {
+		counts += fmt.Sprintf(", %d skipped", r.Skipped)
+	}
+	if len(r.Failures) == 0 {
+		return counts
+	}
+	names := make([]string, 0, len(r.Failures))
+	for _, f := range r.Failures {
+		names = append(names, fmt.Sprintf("%s (%s)", f.Name(), f.Package))
+	}
+	return counts + ": " + strings.Join(names, ", ")
+}
+
+var goTestCmd = regexp.MustCompile(`^\s*go\s+test\b`)
+
+// IsGoTest reports whether the shell command runs `go test` directly.
+func IsGoTest(cmd string) bool {
+	return goTestCmd.MatchString(cmd)
+}
+
+// WithJSON adds -json to a `go test` command that lacks it.
+func WithJSON(cmd string) string {
+	if !IsGoTest(cmd) {
+		return cmd
+	}
+	for _, f := range strings.Fields(cmd) {
+		if f == "-json" || f == "-json=true" {
+			return cmd
+		}
+	}
+	loc := goTestCmd.FindStringIndex(cmd)
+	return cmd[:loc[1]] + " -json" + cmd[loc[1]:]
+}
+
+// Parse reads `go test -json` output, falling back to plain `go test`
+// output. It returns nil when the output contains neither.
+func Parse(output string) *Report {
+	if r := parseJSON(output); r != nil {
+		return r
+	}
+	return parsePlain(output)
+}
+
+// event is one line of `go test -json` output.
+type event struct {
+	Action      string
+	Package     string
+	ImportPath  string
+	Test        string
+	Output      string
+	FailedBuild string
+}
+
+type testKey struct{ pkg, test string }
+
+type outputLine struct {
+	key  testKey
+	text string
+}
+
+func parseJSON(output string) *Report {
+	var (
+		lines    []outputLine
+		outcome  = map[testKey]string{}
+		order    []testKey
+		pkgs     = map[string]*Package{}
+		pkgOrder []string
+		builds   = map[string][]string{}
+		seen     bool
+	)
+	pkg := func(name string) *Package {
+		p, ok := pkgs[name]
+		if !ok {
+			p = &Package{Name: name}
+			pkgs[name] = p
+			pkgOrder = append(pkgOrder, name)
+		}
+		return p
+	}
+	for _, raw := range strings.Split(output, "\n") {
+		var ev event
+		if !strings.HasPrefix(strings.TrimSpace(raw), "{") || json.Unmarshal([]byte(raw), &ev) != nil || ev.Action == "" {
+			if raw != "" {
+				lines = append(lines, outputLine{text: raw + "\n"})
+			}
+			continue
+		}
+		seen = true
+		key := testKey{ev.Package, ev.Test}
+		switch ev.Action {
+		case "build-output":
+			builds[ev.ImportPath] = append(builds[ev.ImportPath], ev.Output)
+			lines = append(lines, outputLine{text: ev.Output})
+		case "output":
+			lines = append(lines, outputLine{key: key, text: ev.Output})
+		case "run":
+			order = append(order, key)
+		case "pass", "fail", "skip":
+			if ev.Test != "" {
+				if _, ok := outcome[key]; !ok && !contains(order, key) {
+					order = append(order, key)
+				}
+				outcome[key] = ev.Action
+				continue
+			}
+			p := pkg(ev.Package)
+			p.Failed = ev.Action == "fail"
+			if ev.FailedBuild != "" {
+				p.BuildFailed = true
+			}
+		case "start":
+			pkg(ev.Package)
+		}
+	}
+	if !seen {
+		return nil
+	}
+
+	r := &Report{}
+	for _, name := range pkgOrder {
+		p := pkgs[name]
+		r.Packages = append(r.Packages, *p)
+	}
+	// Parents of subtests pass or fail with them; only leaves are counted.
+	for _, key := range order {
+		if hasSubtests(order, key) {
+			continue
+		}
+		switch outcome[key] {
+		case "pass":
+			r.Passed++
+		case "skip":
+			r.Skipped++
+		case "fail":
+			r.Failed++
+			r.Failures = append(r.Failures, Failure{Package: key.pkg, Test: key.test, Log: testLog(lines, key)})
+		}
+	}
+	for _, p := range r.Packages {
+		switch {
+		case p.BuildFailed:
+			var log []string
+			for importPath, out := range builds {
+				if importPath == p.Name || strings.HasPrefix(importPath, p.Name+" ") {
+					log = append(log, out...)
+				}
+			}
+			r.Failures = append(r.Failures, Failure{Package: p.Name, Build: true, Log: cleanLog(log)})
+		case p.Failed && !r.hasFailureIn(p.Name):
+			// e.g. a panic in TestMain or init: keep the package's own output.
+			r.Failures = append(r.Failures, Failure{Package: p.Name, Log: testLog(lines, testKey{pkg: p.Name})})
+		}
+	}
+
+	var b strings.Builder
+	for _, l := range lines {
+		if l.key.test != "" && outcome[l.key] != "fail" || isFrame(l.text) {
+			continue
+		}
+		b.WriteString(l.text)
+	}
+	r.Output = b.String()
+	return r
+}
+
+func (r *Report) hasFailureIn(pkg string) bool {
+	for _, f := range r.Failures {
+		if f.Package == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(keys []testKey, k testKey) bool {
+	for _, o := range keys {
+		if o == k {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSubtests(keys []testKey, k testKey) bool {
+	for _, o := range keys {
+		if o.pkg == k.pkg && strings.HasPrefix(o.test, k.test+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isFrame matches the progress lines -json implies (-v) that non-verbose
+// output would not show.
+func isFrame(line string) bool {
+	t := strings.TrimSpace(line)
+	for _, p := range []string{"=== RUN", "=== PAUSE", "=== CONT", "=== NAME", "--- PASS:", "--- SKIP:"} {
+		if strings.HasPrefix(t, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func testLog(lines []outputLine, key testKey) []string {
+	var log []string
+	for _, l := range lines {
+		if l.key == key && !strings.HasPrefix(strings.TrimSpace(l.text), "--- FAIL:") {
+			log = append(log, l.text)
+		}
+	}
+	return cleanLog(log)
+}
+
+func cleanLog(raw []string) []string {
+	var log []string
+	for _, l := range raw {
+		if isFrame(l) {
+			continue
+		}
+		for _, s := range strings.Split(strings.TrimRight(l, "\n"), "\n") {
+			if s = strings.TrimSpace(s); s != "" {
+				log = append(log, s)
+			}
+		}
+	}
+	if len(log) > maxFailureLines {
+		log = append(log[:maxFailureLines], fmt.Sprintf("... (%d more lines)", len(log)-maxFailureLines))
+	}
+	return log
+}
+
+var (
+	plainTest    = regexp.MustCompile(`^(\s*)--- (PASS|FAIL|SKIP): (\S+)`)
+	plainPackage = regexp.MustCompile(`^(ok|FAIL|\?)\s+(\S+)(\s+\[build failed\])?`)
+	plainBuild   = regexp.MustCompile(`^# (\S+)`)
+)
+
+func parsePlain(output string) *Report {
+	r := &Report{Output: output}
+	var (
+		pending []Failure // failing tests whose package line is still ahead
+		current *Failure  // failure collecting indented log lines
+		indent  int
+		build   map[string][]string
+		buildOf string
+	)
+	build = map[string][]string{}
+	for _, line := range strings.Split(output, "\n") {
+		if m := plainTest.FindStringSubmatch(line); m != nil {
+			current, buildOf = nil, ""
+			switch m[2] {
+			case "PASS":
+				r.Passed++
+			case "SKIP":
+				r.Skipped++
+			case "FAIL":
+				// A parent fails with its subtests; keep only the deepest.
+				if n := len(pending); n > 0 && strings.HasPrefix(m[3], pending[n-1].Test+"/") {
+					pending = pending[:n-1]
+				}
+				pending = append(pending, Failure{Test: m[3]})
+				current, indent = &pending[len(pending)-1], len(m[1])
+			}
+			continue
+		}
+		if m := plainPackage.FindStringSubmatch(line); m != nil && m[2] != "" {
+			current, buildOf = nil, ""
+			if m[1] == "?" {
+				continue
+			}
+			p := Package{Name: m[2], Failed: m[1] == "FAIL", BuildFailed: m[3] != ""}
+			r.Packages = append(r.Packages, p)
+			for _, f := range pending {
+				f.Package = p.Name
+				f.Log = cleanLog(f.Log)
+				r.Failures = append(r.Failures, f)
+				r.Failed++
+			}
+			pending = nil
+			if p.BuildFailed {
+				r.Failures = append(r.Failures, Failure{Package: p.Name, Build: true, Log: cleanLog(build[p.Name])})
+			}
+			continue
+		}
+		if m := plainBuild.FindStringSubmatch(line); m != nil {
+			current, buildOf = nil, m[1]
+			continue
+		}
+		switch {
+		case buildOf != "":
+			build[buildOf] = append(build[buildOf], line)
+		case current != nil && leadingSpace(line) > indent:
+			current.Log = append(current.Log, line)
+		default:
+			current = nil
+		}
+	}
+	if len(r.Packages) == 0 && r.Passed+r.Failed+r.Skipped == 0 && len(pending) == 0 {
+		return nil
+	}
+	for _, f := range pending {
+		f.Log = cleanLog(f.Log)
+		r.Failures = append(r.Failures, f)
+		r.Failed++
+	}
+	return r
+}
+
+func leadingSpace(s string) int {
+	return len(s) - len(strings.TrimLeft(s, " \t"))
+}
@@ -0,0 +1,91 @@
+package gotest
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParseJSON(t *testing.T) {
+	r := Parse(readFixture(t, "fail.json"))
+	if r == nil {
+		t.Fatal("no report")
+	}
+	if r.Passed != 3 || r.Failed != 2 || r.Skipped != 1 {
+		t.Fatalf("counts = %d/%d/%d, want 3/2/1", r.Passed, r.Failed, r.Skipped)
+	}
+	want := []Failure{
+		{Package: "example.com/demo/calc", Test: "TestAdd", Log: []string{"calc_test.go:6: checking 2+2", "calc_test.go:8: Add(2, 2) = 0, want 4"}},
+		{Package: "example.com/demo/calc", Test: "TestTable/two", Log: []string{"calc_test.go:16: got 0 want 2"}},
+		{Package: "example.com/demo/broken", Build: true, Log: []string{"# example.com/demo/broken [example.com/demo/broken.test]", "broken/broken.go:3:23: undefined: undefinedThing"}},
+	}
+	if !reflect.DeepEqual(r.Failures, want) {
+		t.Fatalf("failures = %#v", r.Failures)
+	}
+	if len(r.Packages) != 3 || !r.Packages[0].BuildFailed || r.Packages[2].Failed {
+		t.Fatalf("packages = %#v", r.Packages)
+	}
+	for _, hidden := range []string{"=== RUN", "--- PASS", "not on CI"} {
+		if strings.Contains(r.Output, hidden) {
+			t.Errorf("output contains %q:\n%s", hidden, r.Output)
+		}
+	}
+	for _, shown := range []string{"--- FAIL: TestAdd", "Add(2, 2) = 0", "ok  \texample.com/demo/util", "undefined: undefinedThing"} {
+		if !strings.Contains(r.Output, shown) {
+			t.Errorf("output lacks %q:\n%s", shown, r.Output)
+		}
+	}
+}
+
+func TestParsePlain(t *testing.T) {
+	r := Parse(readFixture(t, "fail.txt"))
+	if r == nil {
+		t.Fatal("no report")
+	}
+	if r.Failed != 2 {
+		t.Fatalf("failed = %d, want 2", r.Failed)
+	}
+	got := r.Summary()
+	want := "0 passed, 2 failed: [build failed] (example.com/demo/broken), TestAdd (example.com/demo/calc), TestTable/two (example.com/demo/calc)"
+	if got != want {
+		t.Fatalf("summary = %q, want %q", got, want)
+	}
+	if log := r.Failures[1].Log; len(log) != 2 || log[1] != "calc_test.go:8: Add(2, 2) = 0, want 4" {
+		t.Fatalf("TestAdd log = %q", log)
+	}
+	if log := r.Failures[0].Log; len(log) != 1 || !strings.Contains(log[0], "undefinedThing") {
+		t.Fatalf("build log = %q", log)
+	}
+}
+
+func TestParseOtherOutput(t *testing.T) {
+	if r := Parse("npm ERR! missing script: test\n"); r != nil {
+		t.Fatalf("report = %#v, want nil", r)
+	}
+}
+
+func TestWithJSON(t *testing.T) {
+	cases := map[string]string{
+		"go test ./...":           "go test -json ./...",
+		"  go test -race ./...":   "  go test -json -race ./...",
+		"go test -json ./...":     "go test -json ./...",
+		"go testfoo":              "go testfoo",
+		"make test":               "make test",
+		"cd api && go test ./...": "cd api && go test ./...",
+	}
+	for in, want := range cases {
+		if got := WithJSON(in); got != want {
+			t.Errorf("WithJSON(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -4,18 +4,36 @@ import "time"
 
 // Task is a parsed user instruction ready for execution.
 type Task struct {
-	ID           string
-	Repo         string
-	Branch       string
-	TestCmd      string
-	Mode         string
-	Instruction  string
-	RequesterID  string
-	ChatID       string
-	MessageID    string
-	ReceivedAt   time.Time
-	RawText      string
+	ID          string
+	Repo        string
+	Branch      string
+	TestCmd     string
+	Mode        string
+	Agent       string
+	Instruction string
+	RequesterID string
+	ChatID      string
+	MessageID   string
+	ReceivedAt  time.Time
+	RawText     string
+	// ReplyMessage is the message the task's replies are threaded under, set
+	// for tasks started from group chats.
 	ReplyMessage string
+	Attachments  []Attachment
+}
+
+// Attachment is a file or image sent with a task, either in the instruction
+// message itself or in the message it replies to.
+type Attachment struct {
+	MessageID string
+	Key       string // file_key or image_key
+	Kind      string // "file" or "image"
+	Name      string
+	// Path and Size are set once the resource is downloaded for a run; Text
+	// is the beginning of a text file's content, for the prompt.
+	Path string
+	Size int64
+	Text string `json:"-"`
 }
 
 // Message represents a simplified Feishu message payload used by the runner.
@@ -25,4 +43,54 @@ type Message struct {
 	SenderOpenID string
 	Text         string
 	CreateTime   time.Time
+	// ChatType is "p2p" or "group"; "" when unknown (card actions).
+	ChatType string
+	Mentions []Mention
+	// ReplyTo is the message replies go under as a thread; "" posts them to
+	// the chat.
+	ReplyTo string
+	// ParentID is the message this one replies to, if any.
+	ParentID    string
+	Attachments []Attachment
+}
+
+// ChatTypeP2P is the ChatType of one-on-one chats with the bot.
+const ChatTypeP2P = "p2p"
+
+// Group reports whether the message was sent in a group chat.
+func (m Message) Group() bool {
+	return m.ChatType != "" && m.ChatType != ChatTypeP2P
+}
+
+// Mention is an @mention in a message. Key is its placeholder in the text,
+// e.g. "@_user_1".
+type Mention struct {
+	Key    string
+	OpenID string
+	Name   string
+}
+
+// TaskStatus is the lifecycle phase of a task.
+type TaskStatus string
+
+const (
+	StatusQueued    TaskStatus = "queued"
+	StatusPreparing TaskStatus = "preparing"
+	StatusRunning   TaskStatus = "running"
+	StatusTesting   TaskStatus = "testing"
+	StatusDiffing   TaskStatus = "diffing"
+	StatusSucceeded TaskStatus = "succeeded"
+	StatusFailed    TaskStatus = "failed"
+	StatusCancelled TaskStatus = "cancelled"
+	// StatusInterrupted marks tasks found unfinished after a runner restart.
+	StatusInterrupted TaskStatus = "interrupted"
+)
+
+// Terminal reports whether the task has finished and will not change again.
+func (s TaskStatus) Terminal() bool {
+	switch s {
+	case StatusSucceeded, StatusFailed, StatusCancelled, StatusInterrupted:
+		return true
+	}
+	return false
 }
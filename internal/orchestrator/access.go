@@ -0,0 +1,58 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"feishu-codex-runner/internal/access"
+)
+
+// departmentTTL is how long a user's departments are cached.
+const departmentTTL = 10 * time.Minute
+
+// subject identifies the sender of a request for access checks. Departments
+// are only looked up when some grant names departments.
+func (a *App) subject(ctx context.Context, openID, chatID string) access.Subject {
+	s := access.Subject{OpenID: openID, ChatID: chatID}
+	if a.live().access.NeedsDepartments() {
+		s.Departments = a.departments.get(ctx, openID)
+	}
+	return s
+}
+
+// departmentCache remembers users' departments. Lookup failures are logged
+// and cached like an empty result, so department grants simply do not apply.
+type departmentCache struct {
+	lookup func(ctx context.Context, openID string) ([]string, error)
+
+	mu sync.Mutex
+	m  map[string]departmentEntry
+}
+
+type departmentEntry struct {
+	ids     []string
+	fetched time.Time
+}
+
+func newDepartmentCache(lookup func(ctx context.Context, openID string) ([]string, error)) *departmentCache {
+	return &departmentCache{lookup: lookup, m: map[string]departmentEntry{}}
+}
+
+func (c *departmentCache) get(ctx context.Context, openID string) []string {
+	c.mu.Lock()
+	e, ok := c.m[openID]
+	c.mu.Unlock()
+	if ok && time.Since(e.fetched) < departmentTTL {
+		return e.ids
+	}
+	ids, err := c.lookup(ctx, openID)
+	if err != nil {
+		log.Printf("look up departments of %s: %v", openID, err)
+	}
+	c.mu.Lock()
+	c.m[openID] = departmentEntry{ids: ids, fetched: time.Now()}
+	c.mu.Unlock()
+	return ids
+}
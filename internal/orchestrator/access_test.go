@@ -0,0 +1,47 @@
+package orchestrator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"feishu-codex-runner/internal/access"
+	"feishu-codex-runner/internal/config"
+)
+
+func TestRestrictPublishing(t *testing.T) {
+	rc := config.RepoConfig{Name: "aoi", AutoCommit: true, PushRemote: "origin", CodeHost: "github"}
+	acc := config.Access{
+		Grants: []config.Grant{
+			{Role: config.RoleRunner, Users: []string{"ou_dev"}},
+			{Role: config.RoleViewer, Users: []string{"ou_guest"}},
+		},
+		RolePermissions: map[string][]string{config.RoleRunner: {config.PermView, config.PermRun, config.PermPush}},
+	}
+	policy := access.NewPolicy(acc, []config.RepoConfig{rc})
+
+	got, notes := restrictPublishing(policy, access.Subject{OpenID: "ou_dev"}, rc)
+	if got.PushRemote != "origin" || got.CodeHost != "" || len(notes) != 1 || !strings.Contains(notes[0], "不会创建 PR") {
+		t.Fatalf("runner without pr: %+v %q", got, notes)
+	}
+	got, notes = restrictPublishing(policy, access.Subject{OpenID: "ou_guest"}, rc)
+	if got.PushRemote != "" || got.CodeHost != "github" || len(notes) != 1 || !strings.Contains(notes[0], "缺少 push 权限") {
+		t.Fatalf("viewer: %+v %q", got, notes)
+	}
+}
+
+func TestDepartmentCache(t *testing.T) {
+	calls := 0
+	c := newDepartmentCache(func(context.Context, string) ([]string, error) {
+		calls++
+		return []string{"od_backend"}, nil
+	})
+	for i := 0; i < 3; i++ {
+		if ids := c.get(context.Background(), "ou_dev"); len(ids) != 1 {
+			t.Fatalf("ids = %v", ids)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("lookups = %d, want 1", calls)
+	}
+}
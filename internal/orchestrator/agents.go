@@ -0,0 +1,77 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"feishu-codex-runner/internal/codex"
+	"feishu-codex-runner/internal/config"
+	"feishu-codex-runner/internal/model"
+)
+
+// agentFor picks the coding agent for a task: #agent= first, then the repo's
+// agent, then RUNNER_DEFAULT_AGENT. agent_bin and agent_args from repos.yaml
+// apply only to the repo's own agent.
+func (a *App) agentFor(task model.Task, rc config.RepoConfig) (codex.Agent, error) {
+	repoAgent := rc.Agent
+	if repoAgent == "" {
+		repoAgent = a.cfg.DefaultAgent
+	}
+	name := task.Agent
+	if name == "" {
+		name = repoAgent
+	}
+	var bin string
+	var args []string
+	if name == repoAgent {
+		bin, args = rc.AgentBin, rc.AgentArgs
+	}
+	if bin == "" && name == codex.AgentCodex {
+		bin = a.cfg.CodexBin
+	}
+	return codex.NewAgent(name, bin, args, a.cfg.CodexJSON)
+}
+
+// agentVersions detects agent versions once per executable.
+type agentVersions struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func newAgentVersions() *agentVersions {
+	return &agentVersions{m: map[string]string{}}
+}
+
+// get runs the version lookup without holding the lock, so a slow CLI only
+// delays its own callers; concurrent first lookups may both run it.
+func (v *agentVersions) get(ctx context.Context, agent codex.Agent) string {
+	v.mu.Lock()
+	ver, ok := v.m[agent.Bin()]
+	v.mu.Unlock()
+	if ok {
+		return ver
+	}
+	ver, err := codex.Version(ctx, agent)
+	if err != nil {
+		log.Printf("agent %s: detect version: %v", agent.Name(), err)
+	}
+	v.mu.Lock()
+	v.m[agent.Bin()] = ver
+	v.mu.Unlock()
+	return ver
+}
+
+// logAgentVersions reports the agents configured for each repo at startup so
+// a missing or outdated CLI shows up before the first task.
+func (a *App) logAgentVersions(ctx context.Context) {
+	for _, rc := range a.live().repos {
+		agent, err := a.agentFor(model.Task{}, rc)
+		if err != nil {
+			continue
+		}
+		if ver := a.versions.get(ctx, agent); ver != "" {
+			log.Printf("repo %s: agent %s (%s) %s", rc.Name, agent.Name(), agent.Bin(), ver)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"feishu-codex-runner/internal/config"
+	"feishu-codex-runner/internal/model"
+)
+
+func TestAgentForPrecedence(t *testing.T) {
+	a := &App{cfg: config.Runtime{DefaultAgent: "codex", CodexBin: "/opt/codex"}}
+	plain := config.RepoConfig{Name: "plain"}
+	scripted := config.RepoConfig{Name: "scripted", Agent: "script", AgentBin: "/opt/agent.sh", AgentArgs: []string{"--fast"}}
+
+	cases := []struct {
+		task          model.Task
+		rc            config.RepoConfig
+		wantName, bin string
+	}{
+		{model.Task{}, plain, "codex", "/opt/codex"},
+		{model.Task{}, scripted, "script", "/opt/agent.sh"},
+		{model.Task{Agent: "claude"}, scripted, "claude", "claude"},
+		{model.Task{Agent: "script"}, scripted, "script", "/opt/agent.sh"},
+	}
+	for _, tc := range cases {
+		agent, err := a.agentFor(tc.task, tc.rc)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", tc.rc.Name, tc.task.Agent, err)
+		}
+		if agent.Name() != tc.wantName || agent.Bin() != tc.bin {
+			t.Fatalf("%s/%s: got %s (%s)", tc.rc.Name, tc.task.Agent, agent.Name(), agent.Bin())
+		}
+	}
+	if _, err := a.agentFor(model.Task{Agent: "script"}, plain); err == nil {
+		t.Fatal("#agent=script without a repo agent_bin should fail")
+	}
+}
@@ -0,0 +1,89 @@
+package orchestrator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"feishu-codex-runner/internal/codex"
+	"feishu-codex-runner/internal/model"
+)
+
+// artifactGzipOver is the size above which log and patch files are sent
+// gzipped.
+const artifactGzipOver = 256 << 10
+
+var errArtifactTooLarge = errors.New("artifact too large")
+
+// uploadArtifacts sends the full agent log, test log and patch of a finished
+// task as files in the task's chat or thread, returning the names sent.
+// Problems are reported in one message; the files stay on the runner.
+func (a *App) uploadArtifacts(ctx context.Context, task model.Task, run codex.Result) []string {
+	limit := int64(a.cfg.UploadMaxMB) << 20
+	var sent, notes []string
+	for _, path := range []string{run.LogPath, run.TestLogPath, a.patchPath(task.ID)} {
+		if path == "" {
+			continue
+		}
+		name, data, err := prepareArtifact(path, limit)
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case errors.Is(err, errArtifactTooLarge):
+			notes = append(notes, fmt.Sprintf("%s 压缩后仍超过 %d MB，未上传（runner 本地: %s）", filepath.Base(path), a.cfg.UploadMaxMB, path))
+			continue
+		case err != nil:
+			notes = append(notes, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+			continue
+		case len(data) == 0:
+			continue
+		}
+		key, err := a.feishu.UploadFile(ctx, name, data)
+		if err == nil {
+			err = sendFile(ctx, a.feishu, task.ChatID, task.ReplyMessage, key)
+		}
+		if err != nil {
+			log.Printf("task %s: upload %s: %v", task.ID, name, err)
+			notes = append(notes, fmt.Sprintf("%s 上传失败: %v", name, err))
+			continue
+		}
+		sent = append(sent, name)
+	}
+	if len(notes) > 0 {
+		_ = sendText(ctx, a.feishu, task.ChatID, task.ReplyMessage, "⚠️ 部分日志未作为文件发送:\n"+strings.Join(notes, "\n"))
+	}
+	return sent
+}
+
+// prepareArtifact reads path for upload, gzipping it (and naming it .gz)
+// when it is over artifactGzipOver. errArtifactTooLarge means it is still
+// over limit bytes.
+func prepareArtifact(path string, limit int64) (string, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	name := filepath.Base(path)
+	if len(data) > artifactGzipOver {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Name = name
+		if _, err := zw.Write(data); err != nil {
+			return "", nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return "", nil, err
+		}
+		data, name = buf.Bytes(), name+".gz"
+	}
+	if int64(len(data)) > limit {
+		return "", nil, errArtifactTooLarge
+	}
+	return name, data, nil
+}
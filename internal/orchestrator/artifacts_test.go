@@ -0,0 +1,45 @@
+package orchestrator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrepareArtifact(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "task-1.patch")
+	_ = os.WriteFile(small, []byte("diff --git a/x b/x\n"), 0o644)
+	name, data, err := prepareArtifact(small, 1<<20)
+	if err != nil || name != "task-1.patch" || string(data) != "diff --git a/x b/x\n" {
+		t.Fatalf("small file: %s %q %v", name, data, err)
+	}
+
+	big := filepath.Join(dir, "task-1.log")
+	log := strings.Repeat("ok  \tfeishu-codex-runner/internal/report\t0.002s\n", 10000)
+	_ = os.WriteFile(big, []byte(log), 0o644)
+	name, data, err = prepareArtifact(big, 1<<20)
+	if err != nil || name != "task-1.log.gz" || len(data) >= len(log) {
+		t.Fatalf("large file: %s %d bytes %v", name, len(data), err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != log {
+		t.Fatal("gzipped log does not round-trip")
+	}
+
+	noise := make([]byte, artifactGzipOver*2)
+	rand.New(rand.NewSource(1)).Read(noise)
+	_ = os.WriteFile(big, noise, 0o644)
+	if _, _, err := prepareArtifact(big, artifactGzipOver); !errors.Is(err, errArtifactTooLarge) {
+		t.Fatalf("incompressible file over the limit: err = %v", err)
+	}
+}
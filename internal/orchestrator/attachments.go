@@ -0,0 +1,131 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"feishu-codex-runner/internal/model"
+)
+
+// Attachment limits: larger downloads are refused, and text files are only
+// inlined into the prompt up to attachmentInlineMax bytes each and
+// attachmentInlineTotal bytes in all.
+const (
+	attachmentMaxBytes    = 20 << 20
+	attachmentInlineMax   = 16 << 10
+	attachmentInlineTotal = 48 << 10
+)
+
+// withParentAttachments adds the attachments of the message msg replies to,
+// so a file can be sent first and the instruction as a reply to it.
+func (a *App) withParentAttachments(ctx context.Context, msg model.Message) []model.Attachment {
+	atts := msg.Attachments
+	if msg.ParentID == "" {
+		return atts
+	}
+	parent, err := a.feishu.GetMessage(ctx, msg.ParentID)
+	if err != nil {
+		log.Printf("message %s: get parent %s: %v", msg.MessageID, msg.ParentID, err)
+		return atts
+	}
+	return append(atts, parent.Attachments...)
+}
+
+// downloadAttachments saves the task's attachments in its attachment
+// directory and reads the start of text files for the prompt. Attachments
+// that fail to download are dropped and reported in notes.
+func (a *App) downloadAttachments(ctx context.Context, task model.Task) ([]model.Attachment, []string) {
+	if len(task.Attachments) == 0 {
+		return nil, nil
+	}
+	dir := a.attachmentDir(task.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, []string{"创建附件目录失败: " + err.Error()}
+	}
+	var out []model.Attachment
+	var notes []string
+	inlined := 0
+	used := map[string]bool{}
+	for _, att := range task.Attachments {
+		var buf bytes.Buffer
+		ctype, err := a.feishu.DownloadResource(ctx, att.MessageID, att.Key, att.Kind, &buf, attachmentMaxBytes)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("%s: %v", att.Name, err))
+			continue
+		}
+		att.Path = filepath.Join(dir, attachmentFileName(att, ctype, used))
+		if err := os.WriteFile(att.Path, buf.Bytes(), 0o644); err != nil {
+			notes = append(notes, fmt.Sprintf("%s: %v", att.Name, err))
+			continue
+		}
+		att.Size = int64(buf.Len())
+		if att.Kind == "file" && isText(buf.Bytes()) && inlined < attachmentInlineTotal {
+			att.Text = truncateUTF8(buf.Bytes(), min(attachmentInlineMax, attachmentInlineTotal-inlined))
+			inlined += len(att.Text)
+		}
+		out = append(out, att)
+	}
+	return out, notes
+}
+
+// attachmentDir is WorkDir/attachments/<task_id>. It lives next to the task
+// worktree rather than in it so the files are never committed, and it is
+// removed together with the worktree.
+func (a *App) attachmentDir(taskID string) string {
+	return filepath.Join(a.cfg.WorkDir, "attachments", taskID)
+}
+
+func (a *App) removeAttachments(taskID string) {
+	if err := os.RemoveAll(a.attachmentDir(taskID)); err != nil {
+		log.Printf("task %s: remove attachments: %v", taskID, err)
+	}
+}
+
+// attachmentFileName picks a unique, path-safe file name, adding an
+// extension from the content type when the name has none (images).
+func attachmentFileName(att model.Attachment, ctype string, used map[string]bool) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return '_'
+		}
+		return r
+	}, att.Name)
+	if name == "" || name == "." || name == ".." {
+		name = att.Key
+	}
+	if filepath.Ext(name) == "" {
+		if exts, _ := mime.ExtensionsByType(ctype); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	base, ext := strings.TrimSuffix(name, filepath.Ext(name)), filepath.Ext(name)
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	used[name] = true
+	return name
+}
+
+// isText treats valid UTF-8 without NUL bytes as text.
+func isText(b []byte) bool {
+	return utf8.Valid(b) && !bytes.ContainsRune(b, 0)
+}
+
+// truncateUTF8 cuts b to at most max bytes without splitting a character.
+func truncateUTF8(b []byte, max int) string {
+	if len(b) <= max {
+		return string(b)
+	}
+	b = b[:max]
+	for len(b) > 0 && !utf8.Valid(b) {
+		b = b[:len(b)-1]
+	}
+	return string(b)
+}
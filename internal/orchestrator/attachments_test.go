@@ -0,0 +1,67 @@
+package orchestrator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"feishu-codex-runner/internal/config"
+	"feishu-codex-runner/internal/model"
+	"feishu-codex-runner/internal/repo"
+)
+
+func TestAttachmentFileName(t *testing.T) {
+	used := map[string]bool{}
+	cases := []struct {
+		att   model.Attachment
+		ctype string
+		want  string
+	}{
+		{model.Attachment{Key: "file_1", Name: "panic.log"}, "text/plain", "panic.log"},
+		{model.Attachment{Key: "file_2", Name: "panic.log"}, "text/plain", "panic-2.log"},
+		{model.Attachment{Key: "img_v2_1", Name: "img_v2_1"}, "image/png", "img_v2_1.png"},
+		{model.Attachment{Key: "file_3", Name: "../../etc/passwd"}, "", ".._.._etc_passwd"},
+	}
+	for _, tc := range cases {
+		if got := attachmentFileName(tc.att, tc.ctype, used); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.att.Name, got, tc.want)
+		}
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	if got := truncateUTF8([]byte("日志内容"), 7); got != "日志" {
+		t.Fatalf("got %q", got)
+	}
+	if !isText([]byte("stack trace\n")) || isText([]byte{0x89, 'P', 'N', 'G', 0}) {
+		t.Fatal("text detection")
+	}
+}
+
+func TestAttachmentsRemovedWithWorktree(t *testing.T) {
+	ctx := context.Background()
+	work := t.TempDir()
+	a := &App{cfg: config.Runtime{WorkDir: work, WorktreeCleanup: config.CleanupOnSuccess}}
+	rc := initRepo(t)
+	wt, err := repo.CreateWorktree(ctx, rc, filepath.Join(work, "worktrees"), "t1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(a.attachmentDir("t1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.cleanupWorktree(ctx, "t1", wt, false, false) {
+		t.Fatal("failed task's worktree should be kept")
+	}
+	if _, err := os.Stat(a.attachmentDir("t1")); err != nil {
+		t.Fatalf("attachments of a kept worktree should stay: %v", err)
+	}
+	if !a.cleanupWorktree(ctx, "t1", wt, true, false) {
+		t.Fatal("succeeded task's worktree should be removed")
+	}
+	if _, err := os.Stat(a.attachmentDir("t1")); !os.IsNotExist(err) {
+		t.Fatalf("attachments should be removed with the worktree: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package orchestrator
+
+import (
+	"context"
+	"os"
+
+	"feishu-codex-runner/internal/config"
+	"feishu-codex-runner/internal/model"
+	"feishu-codex-runner/internal/parser"
+	"feishu-codex-runner/internal/report"
+)
+
+// recentTasksListed is how many finished tasks /list shows.
+const recentTasksListed = 10
+
+// diffLinesShown caps the patch sent back for /diff.
+const diffLinesShown = 400
+
+func (a *App) handleCommand(ctx context.Context, msg model.Message, cmd parser.Command) {
+	// Card buttons carry no thread of their own; their replies follow the
+	// task's thread.
+	replyTo := msg.ReplyTo
+	reply := func(text string) { _ = sendText(ctx, a.feishu, msg.ChatID, replyTo, text) }
+	switch cmd.Name {
+	case parser.CmdList:
+		reply(report.List(a.tasks.forRequester(msg.SenderOpenID, recentTasksListed)))
+		return
+	case parser.CmdReload:
+		if err := a.live().access.Check(a.subject(ctx, msg.SenderOpenID, msg.ChatID), "", config.PermConfig); err != nil {
+			reply("⛔ " + err.Error())
+			return
+		}
+		// The admin chat already gets the result from Reload.
+		if text, _ := a.Reload(ctx, "/reload"); msg.ChatID != a.cfg.AdminChatID {
+			reply(text)
+		}
+		return
+	}
+	v, ok := a.tasks.get(cmd.TaskID)
+	if !ok {
+		reply("⚠️ 未找到任务 task_id=" + cmd.TaskID)
+		return
+	}
+	if replyTo == "" {
+		replyTo = v.Task.ReplyMessage
+	}
+	subj := a.subject(ctx, msg.SenderOpenID, msg.ChatID)
+	if err := a.live().access.Check(subj, v.Task.Repo, config.PermView); err != nil {
+		reply("⛔ " + err.Error())
+		return
+	}
+	switch cmd.Name {
+	case parser.CmdStatus:
+		reply(report.Status(v))
+		return
+	case parser.CmdDiff:
+		patch, err := os.ReadFile(a.patchPath(v.Task.ID))
+		if err != nil {
+			reply("⚠️ 该任务暂无 diff\n" + report.Status(v))
+			return
+		}
+		reply(report.FullDiff(v.Task, string(patch), diffLinesShown))
+		return
+	}
+	if v.Task.RequesterID != msg.SenderOpenID {
+		if cmd.Name != parser.CmdCancel {
+			reply("⛔ 只能重试自己提交的任务")
+			return
+		}
+		if err := a.live().access.Check(subj, v.Task.Repo, config.PermCancelOthers); err != nil {
+			reply("⛔ " + err.Error())
+			return
+		}
+	}
+	switch cmd.Name {
+	case parser.CmdCancel:
+		if v.Status.Terminal() {
+			reply("⚠️ 任务已结束，无法取消\n" + report.Status(v))
+			return
+		}
+		if j := a.workers.remove(v.Task.ID); j != nil {
+			a.tasks.setStatus(v.Task.ID, model.StatusCancelled)
+			j.progress.cancelled(ctx)
+			return
+		}
+		// A running task reports its own cancellation once Codex has stopped.
+		if !a.tasks.cancel(v.Task.ID) {
+			reply("⚠️ 任务当前无法取消，请稍后重试")
+		}
+	case parser.CmdRetry:
+		task := v.Task
+		task.ID = makeTaskID(msg.MessageID)
+		task.MessageID = msg.MessageID
+		task.ChatID = msg.ChatID
+		task.ReplyMessage = replyTo
+		task.ReceivedAt = msg.CreateTime
+		a.submit(ctx, task)
+	}
+}
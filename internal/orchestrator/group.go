@@ -0,0 +1,80 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+
+	"feishu-codex-runner/internal/feishu"
+	"feishu-codex-runner/internal/model"
+)
+
+// addressed filters group messages: only those that @mention the bot are for
+// the runner. The bot mention is removed from the text, other mentions are
+// shown by name and replies go to the message's thread. Messages from
+// one-on-one chats pass unchanged.
+func (a *App) addressed(ctx context.Context, msg model.Message) (model.Message, bool) {
+	if !msg.Group() {
+		return msg, true
+	}
+	botID, err := a.feishu.BotOpenID(ctx)
+	if err != nil {
+		log.Printf("message %s: ignored, cannot tell whether the bot is mentioned: %v", msg.MessageID, err)
+		return msg, false
+	}
+	text, ok := stripMention(msg.Text, msg.Mentions, botID)
+	if !ok {
+		return msg, false
+	}
+	msg.Text = text
+	msg.ReplyTo = msg.MessageID
+	return msg, true
+}
+
+// stripMention removes botID's mentions from text and reports whether there
+// were any. Other mention placeholders become "@name".
+func stripMention(text string, mentions []model.Mention, botID string) (string, bool) {
+	// Longest keys first so "@_user_1" does not clobber "@_user_10".
+	sorted := append([]model.Mention(nil), mentions...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i].Key) > len(sorted[j].Key) })
+	found := false
+	for _, m := range sorted {
+		if m.Key == "" {
+			continue
+		}
+		if m.OpenID == botID {
+			text = strings.ReplaceAll(text, m.Key, "")
+			found = true
+			continue
+		}
+		text = strings.ReplaceAll(text, m.Key, "@"+m.Name)
+	}
+	return strings.TrimSpace(text), found
+}
+
+// sendText posts text to the chat, or into the thread of replyTo when set.
+func sendText(ctx context.Context, fc *feishu.Client, chatID, replyTo, text string) error {
+	if replyTo != "" {
+		return fc.ReplyText(ctx, replyTo, text)
+	}
+	return fc.SendText(ctx, chatID, text)
+}
+
+// sendCard posts a card to the chat, or into the thread of replyTo when set,
+// and returns its message ID.
+func sendCard(ctx context.Context, fc *feishu.Client, chatID, replyTo string, card any) (string, error) {
+	if replyTo != "" {
+		return fc.ReplyCard(ctx, replyTo, card)
+	}
+	return fc.SendCard(ctx, chatID, card)
+}
+
+// sendFile posts an uploaded file to the chat, or into the thread of replyTo
+// when set.
+func sendFile(ctx context.Context, fc *feishu.Client, chatID, replyTo, fileKey string) error {
+	if replyTo != "" {
+		return fc.ReplyFile(ctx, replyTo, fileKey)
+	}
+	return fc.SendFile(ctx, chatID, fileKey)
+}
@@ -0,0 +1,21 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"feishu-codex-runner/internal/model"
+)
+
+func TestStripMention(t *testing.T) {
+	mentions := []model.Mention{
+		{Key: "@_user_1", OpenID: "ou_bot", Name: "Codex Runner"},
+		{Key: "@_user_10", OpenID: "ou_lead", Name: "Lead"},
+	}
+	text, ok := stripMention("@_user_1 #repo=aoi 修复 healthz，完成后请 @_user_10 review", mentions, "ou_bot")
+	if !ok || text != "#repo=aoi 修复 healthz，完成后请 @Lead review" {
+		t.Fatalf("got %q ok=%v", text, ok)
+	}
+	if _, ok := stripMention("@_user_10 看一下", mentions[1:], "ou_bot"); ok {
+		t.Fatal("a message that does not mention the bot is not addressed to it")
+	}
+}
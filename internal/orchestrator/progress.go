@@ -0,0 +1,200 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"feishu-codex-runner/internal/codex"
+	"feishu-codex-runner/internal/feishu"
+	"feishu-codex-runner/internal/model"
+	"feishu-codex-runner/internal/report"
+)
+
+// progressRefresh is how often a running task's status card is re-rendered
+// so the elapsed time stays current between phase changes; new Codex output
+// refreshes it at most every progressThrottle.
+const (
+	progressRefresh  = 30 * time.Second
+	progressThrottle = 5 * time.Second
+)
+
+// progress keeps one status card per task up to date. When the card cannot be
+// sent (e.g. the app lacks card permissions) it falls back to the plain text
+// messages and skips the intermediate phases.
+type progress struct {
+	feishu  *feishu.Client
+	task    model.Task
+	started time.Time
+
+	// mu guards the fields below but is never held during a Feishu call.
+	// Card updates go out one at a time: sending is set while one is in
+	// flight, and dirty asks the sender to follow up with the latest state.
+	mu        sync.Mutex
+	sent      *sync.Cond
+	messageID string
+	status    model.TaskStatus
+	position  int
+	repair    int
+	repairs   int
+	output    *codex.Output
+	pushed    time.Time
+	finished  bool
+	sending   bool
+	dirty     bool
+}
+
+// startProgress posts the status card for a newly accepted task.
+func (a *App) startProgress(ctx context.Context, task model.Task) *progress {
+	p := &progress{feishu: a.feishu, task: task, started: time.Now(), status: model.StatusQueued}
+	p.sent = sync.NewCond(&p.mu)
+	id, err := sendCard(ctx, a.feishu, task.ChatID, task.ReplyMessage, p.card())
+	if err != nil {
+		log.Printf("task %s: send status card: %v", task.ID, err)
+		_ = sendText(ctx, a.feishu, task.ChatID, task.ReplyMessage, report.Accepted(task))
+	}
+	p.messageID = id
+	return p
+}
+
+func (p *progress) card() map[string]any {
+	var latest []string
+	if p.output != nil {
+		latest = p.output.Tail(latestLinesShown)
+	}
+	return report.ProgressCard(p.task, report.Progress{
+		Status:     p.status,
+		Elapsed:    time.Since(p.started),
+		Position:   p.position,
+		Latest:     latest,
+		Repair:     p.repair,
+		MaxRepairs: p.repairs,
+	})
+}
+
+// setAttempt notes that repair n of max is starting; the following set call
+// shows it.
+func (p *progress) setAttempt(n, max int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.repair, p.repairs = n, max
+}
+
+// queued shows the task's position in the queue.
+func (p *progress) queued(ctx context.Context, position int) {
+	p.mu.Lock()
+	p.position = position
+	noCard := p.messageID == ""
+	p.mu.Unlock()
+	if noCard {
+		_ = sendText(ctx, p.feishu, p.task.ChatID, p.task.ReplyMessage, report.Queued(p.task, position))
+		return
+	}
+	p.push(ctx)
+}
+
+// set moves the card to a new phase.
+func (p *progress) set(ctx context.Context, status model.TaskStatus) {
+	p.mu.Lock()
+	p.status, p.position = status, 0
+	p.mu.Unlock()
+	p.push(ctx)
+}
+
+// keepFresh re-renders the card every progressRefresh, and as out receives
+// new lines, until stop is called.
+func (p *progress) keepFresh(ctx context.Context, out *codex.Output) (stop func()) {
+	p.mu.Lock()
+	p.output = out
+	p.mu.Unlock()
+	lines, unsubscribe := out.Subscribe(64)
+	done := make(chan struct{})
+	go func() {
+		defer unsubscribe()
+		ticker := time.NewTicker(progressRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+			case _, ok := <-lines:
+				if !ok {
+					// Codex exited; keep ticking through tests and diffing.
+					lines = nil
+					continue
+				}
+			}
+			p.mu.Lock()
+			due := time.Since(p.pushed) >= progressThrottle
+			p.mu.Unlock()
+			if due {
+				p.push(ctx)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// finish replaces the status card with the final card, or posts the result
+// as a new message when there is no card to edit. It waits for an update
+// already in flight so that one cannot overwrite the final card.
+func (p *progress) finish(ctx context.Context, card any, text string) {
+	p.mu.Lock()
+	p.finished = true
+	for p.sending {
+		p.sent.Wait()
+	}
+	p.mu.Unlock()
+	if p.messageID != "" {
+		err := p.feishu.UpdateCard(ctx, p.messageID, card)
+		if err == nil {
+			return
+		}
+		log.Printf("task %s: update status card: %v", p.task.ID, err)
+	}
+	if _, err := sendCard(ctx, p.feishu, p.task.ChatID, p.task.ReplyMessage, card); err != nil {
+		log.Printf("task %s: send card: %v", p.task.ID, err)
+		_ = sendText(ctx, p.feishu, p.task.ChatID, p.task.ReplyMessage, text)
+	}
+}
+
+// cancelled marks the card as cancelled.
+func (p *progress) cancelled(ctx context.Context) {
+	p.mu.Lock()
+	p.status = model.StatusCancelled
+	card := p.card()
+	p.mu.Unlock()
+	p.finish(ctx, card, report.Cancelled(p.task))
+}
+
+// push renders the current state onto the card. If an update is already in
+// flight, its sender sends the new state once it returns.
+func (p *progress) push(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.messageID == "" || p.finished {
+		return
+	}
+	p.dirty = true
+	if p.sending {
+		return
+	}
+	p.sending = true
+	for p.dirty && !p.finished {
+		p.dirty = false
+		p.pushed = time.Now()
+		card := p.card()
+		p.mu.Unlock()
+		err := p.feishu.UpdateCard(ctx, p.messageID, card)
+		p.mu.Lock()
+		if err != nil {
+			log.Printf("task %s: update status card: %v", p.task.ID, err)
+		}
+	}
+	p.sending = false
+	p.sent.Broadcast()
+}
@@ -0,0 +1,77 @@
+package orchestrator
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"feishu-codex-runner/internal/feishu"
+	"feishu-codex-runner/internal/model"
+)
+
+func TestProgressDoesNotBlockOnSlowUpdates(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var patched []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth/v3/tenant_access_token/internal" {
+			_, _ = w.Write([]byte(`{"code":0,"tenant_access_token":"t-123","expire":7200}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		first := len(patched) == 0
+		patched = append(patched, string(body))
+		mu.Unlock()
+		if first {
+			<-release
+		}
+		_, _ = w.Write([]byte(`{"code":0}`))
+	}))
+	defer srv.Close()
+	client := feishu.NewClient("cli_test", "secret")
+	client.SetBaseURL(srv.URL)
+	p := &progress{feishu: client, task: model.Task{ID: "t1"}, started: time.Now(), messageID: "om_card"}
+	p.sent = sync.NewCond(&p.mu)
+	ctx := context.Background()
+
+	go p.set(ctx, model.StatusRunning)
+	for {
+		mu.Lock()
+		n := len(patched)
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		p.setAttempt(1, 2)
+		p.set(ctx, model.StatusTesting)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("set blocked behind a card update in flight")
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		p.finish(ctx, map[string]any{"final": true}, "done")
+		close(finished)
+	}()
+	close(release)
+	<-finished
+	mu.Lock()
+	defer mu.Unlock()
+	if last := patched[len(patched)-1]; !strings.Contains(last, "final") {
+		t.Fatalf("final card must be the last update, got %d updates ending with %s", len(patched), last)
+	}
+}
@@ -0,0 +1,145 @@
+package orchestrator
+
+import (
+	"context"
+	"sync"
+
+	"feishu-codex-runner/internal/codex"
+	"feishu-codex-runner/internal/config"
+	"feishu-codex-runner/internal/model"
+)
+
+// job is an accepted task waiting for, or holding, a worker.
+type job struct {
+	task     model.Task
+	repo     config.RepoConfig
+	agent    codex.Agent
+	progress *progress
+}
+
+// workerPool runs jobs on a bounded number of workers. Jobs targeting
+// different repos run in parallel, jobs targeting the same repo run one at a
+// time in submission order.
+type workerPool struct {
+	size int
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*job
+	busy    map[string]bool
+	running int
+	closed  bool
+}
+
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	p := &workerPool{size: size, busy: map[string]bool{}}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// submit enqueues j and returns its 1-based position among jobs that have
+// not started yet, or 0 when a worker will pick it up right away.
+func (p *workerPool) submit(j *job) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, j)
+	p.cond.Broadcast()
+	// Walk the queue the way workers will: every earlier job whose repo is
+	// idle takes a worker first.
+	idle := p.size - p.running
+	claimed := map[string]bool{}
+	for i, q := range p.pending {
+		startable := !p.busy[q.repo.Name] && !claimed[q.repo.Name]
+		claimed[q.repo.Name] = true
+		if q != j {
+			if startable {
+				idle--
+			}
+			continue
+		}
+		if startable && idle > 0 {
+			return 0
+		}
+		return i + 1
+	}
+	return len(p.pending)
+}
+
+// remove drops a job that has not started yet and returns it, or nil when
+// no such job is pending.
+func (p *workerPool) remove(taskID string) *job {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, j := range p.pending {
+		if j.task.ID == taskID {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			return j
+		}
+	}
+	return nil
+}
+
+// next blocks until a job whose repo is idle is available and claims it.
+// It returns false once the pool is stopped.
+func (p *workerPool) next() (*job, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if p.closed {
+			return nil, false
+		}
+		for i, j := range p.pending {
+			if p.busy[j.repo.Name] {
+				continue
+			}
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			p.busy[j.repo.Name] = true
+			p.running++
+			return j, true
+		}
+		p.cond.Wait()
+	}
+}
+
+// release frees the repo held by j so queued jobs for it can start.
+func (p *workerPool) release(j *job) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.busy, j.repo.Name)
+	p.running--
+	p.cond.Broadcast()
+}
+
+// start launches the workers. They stop taking new jobs once ctx is done;
+// wait blocks until the jobs already running have returned.
+func (p *workerPool) start(ctx context.Context, fn func(context.Context, *job)) {
+	for i := 0; i < p.size; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				j, ok := p.next()
+				if !ok {
+					return
+				}
+				fn(ctx, j)
+				p.release(j)
+			}
+		}()
+	}
+	go func() {
+		<-ctx.Done()
+		p.mu.Lock()
+		p.closed = true
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}()
+}
+
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
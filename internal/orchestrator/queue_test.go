@@ -0,0 +1,114 @@
+package orchestrator
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"feishu-codex-runner/internal/config"
+	"feishu-codex-runner/internal/model"
+)
+
+func newJob(id, repo string) *job {
+	return &job{task: model.Task{ID: id, Repo: repo}, repo: config.RepoConfig{Name: repo}}
+}
+
+func TestWorkerPoolSerializesPerRepo(t *testing.T) {
+	p := newWorkerPool(3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	active := map[string]int{}
+	maxActive := map[string]int{}
+	var order []string
+	release := make(chan struct{})
+	var done sync.WaitGroup
+	p.start(ctx, func(_ context.Context, j *job) {
+		defer done.Done()
+		mu.Lock()
+		active[j.repo.Name]++
+		if active[j.repo.Name] > maxActive[j.repo.Name] {
+			maxActive[j.repo.Name] = active[j.repo.Name]
+		}
+		order = append(order, j.task.ID)
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		active[j.repo.Name]--
+		mu.Unlock()
+	})
+
+	done.Add(4)
+	if pos := p.submit(newJob("a1", "a")); pos != 0 {
+		t.Fatalf("a1 should start immediately, got position %d", pos)
+	}
+	if pos := p.submit(newJob("b1", "b")); pos != 0 {
+		t.Fatalf("b1 should start immediately, got position %d", pos)
+	}
+	waitFor(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(order) == 2 })
+	if pos := p.submit(newJob("a2", "a")); pos != 1 {
+		t.Fatalf("a2 should wait behind a1, got position %d", pos)
+	}
+	if pos := p.submit(newJob("a3", "a")); pos != 2 {
+		t.Fatalf("a3 should be second in queue, got position %d", pos)
+	}
+	close(release)
+	done.Wait()
+	cancel()
+	p.wait()
+
+	if maxActive["a"] != 1 || maxActive["b"] != 1 {
+		t.Fatalf("repos must be serialized, max concurrency: %v", maxActive)
+	}
+	var aOrder []string
+	for _, id := range order {
+		if id[0] == 'a' {
+			aOrder = append(aOrder, id)
+		}
+	}
+	if len(aOrder) != 3 || aOrder[0] != "a1" || aOrder[1] != "a2" || aOrder[2] != "a3" {
+		t.Fatalf("same-repo jobs must run in submission order, got %v", aOrder)
+	}
+}
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	p := newWorkerPool(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	p.start(ctx, func(_ context.Context, j *job) {
+		started <- j.task.ID
+		<-release
+	})
+	if pos := p.submit(newJob("a1", "a")); pos != 0 {
+		t.Fatalf("a1 position %d", pos)
+	}
+	<-started
+	if pos := p.submit(newJob("b1", "b")); pos != 1 {
+		t.Fatalf("b1 must wait for the only worker, got position %d", pos)
+	}
+	select {
+	case id := <-started:
+		t.Fatalf("%s started while the pool was full", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if id := <-started; id != "b1" {
+		t.Fatalf("unexpected job %s", id)
+	}
+	cancel()
+	p.wait()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("condition not met in time")
+}
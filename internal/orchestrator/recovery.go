@@ -0,0 +1,40 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+
+	"feishu-codex-runner/internal/model"
+	"feishu-codex-runner/internal/repo"
+	"feishu-codex-runner/internal/report"
+	"feishu-codex-runner/internal/store"
+)
+
+// recoverInterrupted runs at startup. Tasks a previous process accepted but
+// never finished are marked interrupted, their worktrees are removed when
+// RUNNER_RECOVERY_CLEANUP is set, and requesters are offered a /retry.
+func (a *App) recoverInterrupted(ctx context.Context) {
+	for _, rec := range a.tasks.store.Query(store.TaskFilter{Statuses: activeStatuses}) {
+		log.Printf("task %s was interrupted in status %s", rec.Task.ID, rec.Status)
+		removed := false
+		if rec.Worktree != "" && a.cfg.RecoveryCleanup {
+			removed = a.removeStaleWorktree(ctx, rec)
+		}
+		a.tasks.setStatus(rec.Task.ID, model.StatusInterrupted)
+		_ = sendText(ctx, a.feishu, rec.Task.ChatID, rec.Task.ReplyMessage, report.Interrupted(viewOf(rec), rec.Worktree, removed))
+	}
+}
+
+func (a *App) removeStaleWorktree(ctx context.Context, rec store.TaskRecord) bool {
+	rc, err := a.live().repoMgr.Resolve(rec.Task.Repo)
+	if err != nil {
+		log.Printf("task %s: keep worktree %s: %v", rec.Task.ID, rec.Worktree, err)
+		return false
+	}
+	if err := repo.OpenWorktree(rc, rec.Worktree, rec.WorkBranch).Remove(ctx, false); err != nil {
+		log.Printf("task %s: remove worktree %s: %v", rec.Task.ID, rec.Worktree, err)
+		return false
+	}
+	a.removeAttachments(rec.Task.ID)
+	return true
+}
@@ -0,0 +1,112 @@
+package orchestrator
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"feishu-codex-runner/internal/config"
+	"feishu-codex-runner/internal/feishu"
+	"feishu-codex-runner/internal/model"
+	"feishu-codex-runner/internal/repo"
+	"feishu-codex-runner/internal/store"
+)
+
+func initRepo(t *testing.T) config.RepoConfig {
+	t.Helper()
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	dir := t.TempDir()
+	for _, args := range [][]string{{"init", "-q", "-b", "main"}, {"commit", "-q", "--allow-empty", "-m", "init"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	return config.RepoConfig{Name: "demo", LocalPath: dir, Allowed: true, DefaultBranch: "main"}
+}
+
+// fakeFeishu records the bodies of messages sent through it.
+func fakeFeishu(t *testing.T) (*feishu.Client, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth/v3/tenant_access_token/internal" {
+			_, _ = w.Write([]byte(`{"code":0,"tenant_access_token":"t-123","expire":7200}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		sent = append(sent, string(body))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"code":0,"data":{"message_id":"om_sent"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	c := feishu.NewClient("cli_test", "secret")
+	c.SetBaseURL(srv.URL)
+	return c, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), sent...)
+	}
+}
+
+func TestRecoverInterrupted(t *testing.T) {
+	ctx := context.Background()
+	work := t.TempDir()
+	rc := initRepo(t)
+	wt, err := repo.CreateWorktree(ctx, rc, filepath.Join(work, "worktrees"), "t1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := store.OpenTaskStore(filepath.Join(work, "tasks.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	for _, task := range []model.Task{
+		{ID: "t1", Repo: "demo", ChatID: "oc_1", Instruction: "fix healthz"},
+		{ID: "t2", Repo: "demo", ChatID: "oc_1", Instruction: "done already"},
+	} {
+		if err := st.Create(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = st.SetStatus("t1", model.StatusRunning)
+	_ = st.SetWorktree("t1", wt.Path, wt.Branch)
+	_ = st.SetStatus("t2", model.StatusSucceeded)
+
+	client, sent := fakeFeishu(t)
+	a := &App{
+		cfg:    config.Runtime{WorkDir: work, RecoveryCleanup: true},
+		feishu: client,
+		tasks:  newTaskRegistry(st),
+	}
+	a.settings.Store(&settings{repos: []config.RepoConfig{rc}, repoMgr: repo.NewManager([]config.RepoConfig{rc})})
+	a.recoverInterrupted(ctx)
+
+	if rec, _ := st.Get("t1"); rec.Status != model.StatusInterrupted {
+		t.Fatalf("active task should be interrupted, got %s", rec.Status)
+	}
+	if rec, _ := st.Get("t2"); rec.Status != model.StatusSucceeded {
+		t.Fatalf("finished task should be left alone, got %s", rec.Status)
+	}
+	if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+		t.Fatalf("worktree should be removed with RecoveryCleanup: %v", err)
+	}
+	msgs := sent()
+	if len(msgs) != 1 || !strings.Contains(msgs[0], "/retry t1") || !strings.Contains(msgs[0], "工作区已清理") {
+		t.Fatalf("expected one /retry hint, got %q", msgs)
+	}
+}
@@ -0,0 +1,175 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"time"
+
+	"feishu-codex-runner/internal/access"
+	"feishu-codex-runner/internal/config"
+	"feishu-codex-runner/internal/model"
+	"feishu-codex-runner/internal/parser"
+	"feishu-codex-runner/internal/repo"
+	"feishu-codex-runner/internal/report"
+)
+
+// configPollInterval is how often the configuration files are checked for
+// changes.
+const configPollInterval = 2 * time.Second
+
+// settings is the part of the configuration that can be reloaded while the
+// runner is up. Queued and running tasks keep the repo settings they were
+// accepted with.
+type settings struct {
+	repos     []config.RepoConfig
+	acc       config.Access
+	repoMgr   *repo.Manager
+	access    *access.Policy
+	parseOpts parser.ParseOptions
+}
+
+func (a *App) live() *settings {
+	return a.settings.Load()
+}
+
+// newSettings builds reloadable settings, failing if a repo's agent is
+// misconfigured.
+func (a *App) newSettings(repos []config.RepoConfig, acc config.Access) (*settings, error) {
+	for _, rc := range repos {
+		if _, err := a.agentFor(model.Task{}, rc); err != nil {
+			return nil, fmt.Errorf("repo %s: %w", rc.Name, err)
+		}
+	}
+	return &settings{
+		repos:     repos,
+		acc:       acc,
+		repoMgr:   repo.NewManager(repos),
+		access:    access.NewPolicy(acc, repos),
+		parseOpts: parseOptions(a.cfg, repos),
+	}, nil
+}
+
+// Reload re-reads the configuration and swaps in the new repos and access
+// rules if they are valid; otherwise the current ones stay in effect. The
+// outcome is logged, sent to the admin chat and returned as a message.
+// Runtime and policy settings only take effect after a restart.
+func (a *App) Reload(ctx context.Context, source string) (string, error) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+	conf, err := config.Load()
+	var next *settings
+	if err == nil {
+		next, err = a.newSettings(conf.Repos, conf.Access)
+	}
+	if err != nil {
+		log.Printf("config reload (%s) failed, keeping current config:\n%v", source, err)
+		msg := report.ReloadFailed(source, err)
+		a.notifyAdmin(ctx, msg)
+		return msg, err
+	}
+	prev := a.settings.Swap(next)
+	changes := repoChanges(prev.repos, next.repos)
+	changes.Access = !reflect.DeepEqual(prev.acc, next.acc)
+	changes.Runtime = !reflect.DeepEqual(conf.Runtime, a.cfg)
+	log.Printf("config reloaded (%s): %d repos, added=%v removed=%v changed=%v access changed=%t restart needed=%t",
+		source, len(next.repos), changes.Added, changes.Removed, changes.Changed, changes.Access, changes.Runtime)
+	msg := report.Reloaded(source, changes)
+	a.notifyAdmin(ctx, msg)
+	return msg, nil
+}
+
+func (a *App) notifyAdmin(ctx context.Context, text string) {
+	if a.cfg.AdminChatID == "" {
+		return
+	}
+	if err := a.feishu.SendText(ctx, a.cfg.AdminChatID, text); err != nil {
+		log.Printf("notify admin chat: %v", err)
+	}
+}
+
+// repoChanges compares repo lists by name.
+func repoChanges(prev, next []config.RepoConfig) report.ReloadChanges {
+	var c report.ReloadChanges
+	old := make(map[string]config.RepoConfig, len(prev))
+	for _, rc := range prev {
+		old[rc.Name] = rc
+	}
+	for _, rc := range next {
+		was, ok := old[rc.Name]
+		switch {
+		case !ok:
+			c.Added = append(c.Added, rc.Name)
+		case !reflect.DeepEqual(was, rc):
+			c.Changed = append(c.Changed, rc.Name)
+		}
+		delete(old, rc.Name)
+	}
+	for _, rc := range prev {
+		if _, ok := old[rc.Name]; ok {
+			c.Removed = append(c.Removed, rc.Name)
+		}
+	}
+	return c
+}
+
+// configFiles lists the files a reload reads.
+func (a *App) configFiles() []string {
+	var paths []string
+	for _, p := range []string{a.cfg.ConfigFile, a.cfg.ReposFile, a.cfg.AllowListFile} {
+		if p != "" && !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// configWatcher polls files for changes and calls onChange once they have
+// stayed unchanged for a whole interval, so an editor saving in several
+// writes triggers a single reload.
+type configWatcher struct {
+	paths    []string
+	interval time.Duration
+	onChange func()
+}
+
+type fileStamp struct {
+	exists bool
+	size   int64
+	mod    time.Time
+}
+
+func stamps(paths []string) []fileStamp {
+	out := make([]fileStamp, len(paths))
+	for i, p := range paths {
+		if st, err := os.Stat(p); err == nil {
+			out[i] = fileStamp{exists: true, size: st.Size(), mod: st.ModTime()}
+		}
+	}
+	return out
+}
+
+func (w *configWatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	last := stamps(w.paths)
+	pending := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if cur := stamps(w.paths); !slices.Equal(cur, last) {
+			last, pending = cur, true
+			continue
+		}
+		if pending {
+			pending = false
+			w.onChange()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package orchestrator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"feishu-codex-runner/internal/config"
+)
+
+func TestReloadSwapsValidConfig(t *testing.T) {
+	d := t.TempDir()
+	p := filepath.Join(d, "runner.yaml")
+	base := "runtime:\n  feishu_app_id: a\n  feishu_app_secret: b\n  work_dir: " + filepath.Join(d, "data") + "\nallowlist:\n  open_ids: [ou_a]\n"
+	write := func(repos string) {
+		if err := os.WriteFile(p, []byte(base+repos), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("RUNNER_CONFIG", p)
+	write("repos:\n  - name: aoi\n    local_path: " + d + "\n    allowed: true\n")
+	conf, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &App{cfg: conf.Runtime}
+	s, err := a.newSettings(conf.Repos, conf.Access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.settings.Store(s)
+
+	write("repos:\n  - name: aoi\n    local_path: " + d + "\n    allowed: true\n    test_cmd: make test\n  - name: kiri\n    local_path: " + d + "\n    allowed: true\n")
+	msg, err := a.Reload(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("reload: %v\n%s", err, msg)
+	}
+	if _, err := a.live().repoMgr.Resolve("kiri"); err != nil {
+		t.Fatalf("new repo not live: %v", err)
+	}
+	if a.live().parseOpts.RepoTestCmds["aoi"] != "make test" {
+		t.Fatalf("repo test command not reloaded: %+v", a.live().parseOpts)
+	}
+	for _, want := range []string{"新增仓库: kiri", "变更仓库: aoi", "权限规则: 无变化"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("reload message lacks %q:\n%s", want, msg)
+		}
+	}
+
+	prev := a.live()
+	write("repos:\n  - name: aoi\n    local_path: " + filepath.Join(d, "missing") + "\n")
+	if _, err := a.Reload(context.Background(), "test"); err == nil {
+		t.Fatal("invalid config should be rejected")
+	}
+	if a.live() != prev {
+		t.Fatal("failed reload must keep the current settings")
+	}
+}
+
+func TestConfigWatcherFiresOnceAfterChange(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "repos.yaml")
+	_ = os.WriteFile(p, []byte("repos: []\n"), 0o644)
+	fired := make(chan struct{}, 4)
+	w := &configWatcher{paths: []string{p}, interval: 20 * time.Millisecond, onChange: func() { fired <- struct{}{} }}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.run(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	_ = os.WriteFile(p, []byte("repos:\n  - name: aoi\n"), 0o644)
+	select {
+	case <-fired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("watcher did not report the change")
+	}
+	select {
+	case <-fired:
+		t.Fatal("watcher fired twice for one change")
+	case <-time.After(150 * time.Millisecond):
+	}
+}
@@ -0,0 +1,118 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"feishu-codex-runner/internal/codex"
+	"feishu-codex-runner/internal/config"
+	"feishu-codex-runner/internal/model"
+)
+
+// flakyTests fails on its first run and passes afterwards.
+const flakyTests = `n=$(cat .runs 2>/dev/null || echo 0); echo $((n+1)) > .runs; echo "run $n"; [ "$n" -ge 1 ] || { echo "--- FAIL: TestHealthz"; exit 1; }`
+
+func TestExecuteRepairsFailingTests(t *testing.T) {
+	bin, _ := filepath.Abs(filepath.Join("..", "codex", "testdata", "fake-agent"))
+	agent, err := codex.NewAgent(codex.AgentScript, bin, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	a := &App{
+		cfg:   config.Runtime{RepairAttempts: 3},
+		codex: codex.Runner{WorkDir: filepath.Join(dir, "logs"), Timeout: 10 * time.Second},
+	}
+	j := &job{task: model.Task{ID: "t1", Instruction: "fix healthz", TestCmd: flakyTests}, agent: agent}
+
+	var phases []string
+	run, ok := a.execute(context.Background(), j, dir, nil, func(s model.TaskStatus, repair int) {
+		phases = append(phases, fmt.Sprintf("%s/%d", s, repair))
+	})
+	if !ok || run.TestErr != nil {
+		t.Fatalf("expected tests to pass after a repair: ok=%v err=%v", ok, run.TestErr)
+	}
+	if len(run.Attempts) != 2 || run.Attempts[0].TestErr == nil || run.Attempts[1].TestErr != nil {
+		t.Fatalf("unexpected attempts: %+v", run.Attempts)
+	}
+	if got := strings.Join(phases, ","); got != "running/0,testing/0,running/1,testing/1" {
+		t.Fatalf("unexpected phases %s", got)
+	}
+	log, _ := os.ReadFile(run.LogPath)
+	if !strings.Contains(string(log), "--- FAIL: TestHealthz") || !strings.Contains(string(log), "原始任务：fix healthz") {
+		t.Fatalf("repair prompt should carry the failure and the original task:\n%s", log)
+	}
+}
+
+func TestExecuteStopsAtAttemptLimit(t *testing.T) {
+	bin, _ := filepath.Abs(filepath.Join("..", "codex", "testdata", "fake-agent"))
+	agent, _ := codex.NewAgent(codex.AgentScript, bin, nil, false)
+	dir := t.TempDir()
+	a := &App{
+		cfg:   config.Runtime{RepairAttempts: 1},
+		codex: codex.Runner{WorkDir: filepath.Join(dir, "logs"), Timeout: 10 * time.Second},
+	}
+	j := &job{task: model.Task{ID: "t2", Instruction: "fix", TestCmd: "exit 1"}, agent: agent}
+	run, _ := a.execute(context.Background(), j, dir, nil, func(model.TaskStatus, int) {})
+	if run.TestErr == nil || len(run.Attempts) != 2 {
+		t.Fatalf("expected 1 run + 1 repair, got %d attempts", len(run.Attempts))
+	}
+
+	a.cfg.RepairBudget = time.Nanosecond
+	run, _ = a.execute(context.Background(), j, dir, nil, func(model.TaskStatus, int) {})
+	if len(run.Attempts) != 1 {
+		t.Fatalf("exhausted budget should prevent repairs, got %d attempts", len(run.Attempts))
+	}
+}
+
+func TestExecuteAppliesRepoSettings(t *testing.T) {
+	bin, _ := filepath.Abs(filepath.Join("..", "codex", "testdata", "fake-agent"))
+	agent, _ := codex.NewAgent(codex.AgentScript, bin, nil, false)
+	dir := t.TempDir()
+	a := &App{
+		cfg:   config.Runtime{RepairAttempts: 1},
+		codex: codex.Runner{WorkDir: filepath.Join(dir, "logs"), Timeout: 10 * time.Second},
+	}
+	rc := config.RepoConfig{
+		Name:           "aoi",
+		Env:            map[string]string{"AOI_MODE": "ci"},
+		PromptPreamble: "本仓库使用 zap 记录日志。",
+		LintCmd:        `[ -f .linted ] || { touch .linted; echo "main.go:3: unused import"; exit 1; }`,
+	}
+	j := &job{task: model.Task{ID: "t3", Instruction: "fix", TestCmd: `test "$AOI_MODE" = ci`}, repo: rc, agent: agent}
+	run, _ := a.execute(context.Background(), j, dir, nil, func(model.TaskStatus, int) {})
+	if run.TestErr != nil || run.LintErr != nil {
+		t.Fatalf("expected env for tests and a lint repair: test=%v lint=%v", run.TestErr, run.LintErr)
+	}
+	if len(run.Attempts) != 2 || run.Attempts[0].LintErr == nil {
+		t.Fatalf("lint failure should trigger a repair: %+v", run.Attempts)
+	}
+	log, _ := os.ReadFile(run.LogPath)
+	if !strings.Contains(string(log), "stdin: 本仓库使用 zap 记录日志。") || !strings.Contains(string(log), "main.go:3: unused import") {
+		t.Fatalf("prompt should start with the preamble and repairs carry lint output:\n%s", log)
+	}
+}
+
+func TestExecuteBudgetBoundsTests(t *testing.T) {
+	bin, _ := filepath.Abs(filepath.Join("..", "codex", "testdata", "fake-agent"))
+	agent, _ := codex.NewAgent(codex.AgentScript, bin, nil, false)
+	dir := t.TempDir()
+	a := &App{
+		cfg:   config.Runtime{RepairAttempts: 2, RepairBudget: 2 * time.Second},
+		codex: codex.Runner{WorkDir: filepath.Join(dir, "logs"), Timeout: 10 * time.Second},
+	}
+	j := &job{task: model.Task{ID: "t4", Instruction: "fix", TestCmd: "exec sleep 30"}, agent: agent}
+	start := time.Now()
+	run, ok := a.execute(context.Background(), j, dir, nil, func(model.TaskStatus, int) {})
+	if !ok || run.ExitErr == nil && run.TestErr == nil {
+		t.Fatalf("expected the budget to stop the run: ok=%v %+v", ok, run.Attempts)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("budget of 2s did not bound the tests, took %s", d)
+	}
+}
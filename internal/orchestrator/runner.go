@@ -4,11 +4,21 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"feishu-codex-runner/internal/access"
+	"feishu-codex-runner/internal/codehost"
 	"feishu-codex-runner/internal/codex"
 	"feishu-codex-runner/internal/config"
 	"feishu-codex-runner/internal/feishu"
@@ -19,36 +29,118 @@ import (
 	"feishu-codex-runner/internal/store"
 )
 
+// chatRefresh is how often the group chats the bot is in are re-listed for
+// polling.
+const chatRefresh = 5 * time.Minute
+
+// pollOverlap is how far before the poll start a chat's cursor is set when
+// it had no newer messages, for messages that show up in the list late.
+const pollOverlap = time.Minute
+
+// outputLinesKept is how many recent Codex output lines stay in memory per
+// running task.
+const outputLinesKept = 200
+
 type App struct {
-	cfg       config.Runtime
-	feishu    *feishu.Client
-	repoMgr   *repo.Manager
-	allowList map[string]struct{}
-	store     *store.JSONStore
-	codex     codex.Runner
-	state     store.State
-	parseOpts parser.ParseOptions
+	cfg         config.Runtime
+	feishu      *feishu.Client
+	longConn    *feishu.WSClient
+	settings    atomic.Pointer[settings]
+	reloadMu    sync.Mutex
+	departments *departmentCache
+	store       *store.JSONStore
+	codex       codex.Runner
+	state       store.State
+	workers     *workerPool
+	tasks       *taskRegistry
+	versions    *agentVersions
+
+	// Group chats found by pollChats, used by the poll loop only.
+	groups       []string
+	groupsListed time.Time
 }
 
-func New(cfg config.Runtime, repos []config.RepoConfig, allow map[string]struct{}) (*App, error) {
+func New(cfg config.Runtime, repos []config.RepoConfig, acc config.Access) (*App, error) {
 	st := store.NewJSONStore(filepath.Join(cfg.WorkDir, "state.json"))
 	state, err := st.Load()
 	if err != nil {
 		return nil, err
 	}
-	return &App{
-		cfg:       cfg,
-		feishu:    feishu.NewClient(cfg.FeishuAppID, cfg.FeishuAppSecret),
-		repoMgr:   repo.NewManager(repos),
-		allowList: allow,
-		store:     st,
-		state:     state,
-		codex:     codex.Runner{Bin: cfg.CodexBin, WorkDir: filepath.Join(cfg.WorkDir, "logs"), Timeout: cfg.ExecutionTimeout, MaxOutput: 12000},
-		parseOpts: parser.ParseOptions{DefaultTestCmd: cfg.DefaultTestCmd},
-	}, nil
+	tasks, err := store.OpenTaskStore(filepath.Join(cfg.WorkDir, "tasks.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	a := &App{
+		cfg:      cfg,
+		feishu:   feishu.NewClient(cfg.FeishuAppID, cfg.FeishuAppSecret),
+		longConn: feishu.NewWSClient(cfg.FeishuAppID, cfg.FeishuAppSecret),
+		store:    st,
+		state:    state,
+		codex:    codex.Runner{WorkDir: filepath.Join(cfg.WorkDir, "logs"), Timeout: cfg.ExecutionTimeout, MaxOutput: 12000},
+		workers:  newWorkerPool(cfg.Workers),
+		tasks:    newTaskRegistry(tasks),
+		versions: newAgentVersions(),
+	}
+	a.departments = newDepartmentCache(a.feishu.UserDepartments)
+	s, err := a.newSettings(repos, acc)
+	if err != nil {
+		return nil, err
+	}
+	a.settings.Store(s)
+	return a, nil
 }
 
 func (a *App) Run(ctx context.Context) error {
+	a.recoverInterrupted(ctx)
+	a.logAgentVersions(ctx)
+	a.workers.start(ctx, a.runJob)
+	defer a.workers.wait()
+	watcher := &configWatcher{paths: a.configFiles(), interval: configPollInterval, onChange: func() {
+		_, _ = a.Reload(ctx, "配置文件变更")
+	}}
+	go watcher.run(ctx)
+	switch a.cfg.EventMode {
+	case config.EventModeLongConn:
+		return a.longConn.Run(ctx, a.receive)
+	case config.EventModeWebhook:
+		return a.serveWebhook(ctx)
+	}
+	return a.poll(ctx)
+}
+
+// serveWebhook runs the event callback server. Callbacks only enqueue the
+// message; a single loop handles them so message handling stays sequential
+// and callbacks are answered within Feishu's deadline.
+func (a *App) serveWebhook(ctx context.Context) error {
+	inbox := make(chan model.Message, 64)
+	mux := http.NewServeMux()
+	mux.Handle(a.cfg.WebhookPath, feishu.NewWebhookHandler(a.cfg.VerificationToken, a.cfg.EncryptKey, func(rctx context.Context, msg model.Message) {
+		select {
+		case inbox <- msg:
+		case <-rctx.Done():
+		}
+	}))
+	srv := &http.Server{Addr: a.cfg.WebhookAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+	defer func() {
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(sctx)
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errCh:
+			return fmt.Errorf("webhook server: %w", err)
+		case msg := <-inbox:
+			a.receive(ctx, msg)
+		}
+	}
+}
+
+func (a *App) poll(ctx context.Context) error {
 	ticker := time.NewTicker(a.cfg.PollInterval)
 	defer ticker.Stop()
 	if err := a.pollOnce(ctx); err != nil {
@@ -66,60 +158,479 @@ func (a *App) Run(ctx context.Context) error {
 	}
 }
 
+// pollOnce reads the new messages of every polled chat. A failing chat does
+// not hold up the others; its cursor keeps the position reached.
 func (a *App) pollOnce(ctx context.Context) error {
-	start := time.Unix(a.state.LastPollUnix, 0)
-	if a.state.LastPollUnix == 0 {
-		start = time.Now().Add(-30 * time.Minute)
-	}
-	msgs, cursor, err := a.feishu.FetchMessages(ctx, start, a.state.Cursor)
+	started := time.Now()
+	chats, err := a.pollChats(ctx)
 	if err != nil {
 		return err
 	}
-	for _, msg := range msgs {
-		if _, seen := a.state.Processed[msg.MessageID]; seen {
-			continue
+	var errs []error
+	for _, chatID := range chats {
+		if err := a.pollChat(ctx, chatID, started); err != nil {
+			errs = append(errs, fmt.Errorf("chat %s: %w", chatID, err))
+		}
+	}
+	if len(errs) == 0 {
+		a.state.LastPollUnix = started.Unix()
+	}
+	if err := a.store.Save(a.state); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// pollChat reads a chat's new messages page by page until there are no
+// more, saving the cursor after each page so a restart or error resumes
+// where it stopped.
+func (a *App) pollChat(ctx context.Context, chatID string, started time.Time) error {
+	cur, ok := a.state.Chats[chatID]
+	if !ok {
+		cur.StartUnix = a.state.LastPollUnix
+		if cur.StartUnix == 0 {
+			cur.StartUnix = time.Now().Add(-30 * time.Minute).Unix()
+		}
+	}
+	newest := cur.StartUnix
+	for {
+		msgs, next, err := a.feishu.FetchMessages(ctx, chatID, time.Unix(cur.StartUnix, 0), cur.PageToken)
+		if err != nil {
+			a.state.Chats[chatID] = cur
+			return err
+		}
+		for _, msg := range msgs {
+			newest = max(newest, msg.CreateTime.Unix())
+			if !a.markProcessed(msg.MessageID) {
+				continue
+			}
+			a.handleMessage(ctx, msg)
+		}
+		if next == "" {
+			break
+		}
+		cur.PageToken = next
+		a.state.Chats[chatID] = cur
+		if err := a.store.Save(a.state); err != nil {
+			return err
+		}
+	}
+	// The start time is inclusive; messages of that second that were
+	// already handled are skipped as processed. Quiet chats move up to the
+	// poll start too, so the cursor never falls behind the pruning of
+	// processed IDs.
+	newest = max(newest, started.Add(-pollOverlap).Unix())
+	a.state.Chats[chatID] = store.ChatCursor{StartUnix: newest}
+	return nil
+}
+
+// pollChats returns RUNNER_POLL_CHATS plus the group chats the bot is in,
+// re-listed every chatRefresh. Private chats cannot be listed, so they are
+// only polled when configured.
+func (a *App) pollChats(ctx context.Context) ([]string, error) {
+	if a.groupsListed.IsZero() || time.Since(a.groupsListed) >= chatRefresh {
+		groups, err := a.feishu.ListChats(ctx)
+		switch {
+		case err == nil:
+			a.groups, a.groupsListed = groups, time.Now()
+		case a.groupsListed.IsZero() && len(a.cfg.PollChats) == 0:
+			return nil, err
+		default:
+			log.Printf("%v (polling the chats already known)", err)
+		}
+	}
+	chats := slices.Clone(a.cfg.PollChats)
+	for _, id := range a.groups {
+		if !slices.Contains(chats, id) {
+			chats = append(chats, id)
 		}
-		a.state.Processed[msg.MessageID] = time.Now().Unix()
-		a.handleMessage(ctx, msg)
 	}
-	a.state.Cursor = cursor
-	a.state.LastPollUnix = time.Now().Unix()
-	return a.store.Save(a.state)
+	return chats, nil
+}
+
+// receive handles a pushed message event. Events can be redelivered, so the
+// processed set is consulted and persisted just like for polled messages.
+// It is saved only once the task is in the task store: after a crash in
+// between, the redelivered event is handled again or the task recovered.
+func (a *App) receive(ctx context.Context, msg model.Message) {
+	if !a.markProcessed(msg.MessageID) {
+		return
+	}
+	a.handleMessage(ctx, msg)
+	if err := a.store.Save(a.state); err != nil {
+		log.Printf("save state: %v", err)
+	}
+}
+
+// markProcessed records msgID and reports whether it had not been seen before.
+func (a *App) markProcessed(msgID string) bool {
+	if _, seen := a.state.Processed[msgID]; seen {
+		return false
+	}
+	a.state.Processed[msgID] = time.Now().Unix()
+	return true
 }
 
 func (a *App) handleMessage(ctx context.Context, msg model.Message) {
-	if _, ok := a.allowList[msg.SenderOpenID]; !ok {
-		_ = a.feishu.SendText(ctx, msg.ChatID, "⛔ 无权限触发 runner")
+	if a.tasks.seenMessage(msg.MessageID) {
+		return
+	}
+	msg, ok := a.addressed(ctx, msg)
+	if !ok {
+		return
+	}
+	if !a.live().access.Known(a.subject(ctx, msg.SenderOpenID, msg.ChatID)) {
+		_ = sendText(ctx, a.feishu, msg.ChatID, msg.ReplyTo, "⛔ 无权限触发 runner")
+		return
+	}
+	if cmd, ok, err := parser.ParseCommand(msg.Text); ok {
+		if err != nil {
+			_ = sendText(ctx, a.feishu, msg.ChatID, msg.ReplyTo, "⚠️ 指令解析失败: "+err.Error())
+			return
+		}
+		a.handleCommand(ctx, msg, cmd)
 		return
 	}
-	task, err := parser.ParseMessage(msg, a.parseOpts)
+	task, err := parser.ParseMessage(msg, a.live().parseOpts)
 	if err != nil {
-		_ = a.feishu.SendText(ctx, msg.ChatID, "⚠️ 指令解析失败: "+err.Error())
+		_ = sendText(ctx, a.feishu, msg.ChatID, msg.ReplyTo, "⚠️ 指令解析失败: "+err.Error())
 		return
 	}
 	task.ID = makeTaskID(msg.MessageID)
+	task.ReplyMessage = msg.ReplyTo
+	task.Attachments = a.withParentAttachments(ctx, msg)
+	a.submit(ctx, task)
+}
+
+// submit validates a parsed task and hands it to the worker pool.
+func (a *App) submit(ctx context.Context, task model.Task) {
 	if err := codex.ValidateSafety(task.Instruction); err != nil {
-		_ = a.feishu.SendText(ctx, msg.ChatID, "⛔ 任务被拒绝: "+err.Error())
+		_ = sendText(ctx, a.feishu, task.ChatID, task.ReplyMessage, "⛔ 任务被拒绝: "+err.Error())
+		return
+	}
+	live := a.live()
+	rc, err := live.repoMgr.Resolve(task.Repo)
+	if err != nil {
+		_ = sendText(ctx, a.feishu, task.ChatID, task.ReplyMessage, "⛔ Repo 校验失败: "+err.Error())
+		return
+	}
+	subj := a.subject(ctx, task.RequesterID, task.ChatID)
+	if err := live.access.Check(subj, rc.Name, config.PermRun); err != nil {
+		_ = sendText(ctx, a.feishu, task.ChatID, task.ReplyMessage, "⛔ "+err.Error())
+		return
+	}
+	rc, notes := restrictPublishing(live.access, subj, rc)
+	if len(notes) > 0 {
+		_ = sendText(ctx, a.feishu, task.ChatID, task.ReplyMessage, "ℹ️ "+strings.Join(notes, "\n"))
+	}
+	if err := repo.CheckBranch(rc, task.Branch); err != nil {
+		_ = sendText(ctx, a.feishu, task.ChatID, task.ReplyMessage, "⛔ 分支校验失败: "+err.Error())
+		return
+	}
+	agent, err := a.agentFor(task, rc)
+	if err != nil {
+		_ = sendText(ctx, a.feishu, task.ChatID, task.ReplyMessage, "⛔ Agent 配置错误: "+err.Error())
+		return
+	}
+	a.tasks.add(task)
+	p := a.startProgress(ctx, task)
+	if pos := a.workers.submit(&job{task: task, repo: rc, agent: agent, progress: p}); pos > 0 {
+		p.queued(ctx, pos)
+	}
+}
+
+// runJob executes an accepted task on a worker inside its own git worktree.
+// The run can be aborted with /cancel, which cancels runCtx. Each phase is
+// reflected on the task's status card.
+func (a *App) runJob(ctx context.Context, j *job) {
+	task, rc, p := j.task, j.repo, j.progress
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a.tasks.setCancel(task.ID, cancel)
+	out := codex.NewOutput(outputLinesKept)
+	defer out.Close()
+	a.tasks.setOutput(task.ID, out)
+	defer p.keepFresh(ctx, out)()
+	setStatus := func(status model.TaskStatus) {
+		a.tasks.setStatus(task.ID, status)
+		p.set(ctx, status)
+	}
+
+	setStatus(model.StatusPreparing)
+	// shutdown reports whether the whole runner is stopping. The task then
+	// keeps its active status so recoverInterrupted offers a /retry on the
+	// next start.
+	shutdown := func() bool {
+		if ctx.Err() == nil {
+			return false
+		}
+		log.Printf("task %s: runner shutting down, left for recovery", task.ID)
+		return true
+	}
+	wt, err := repo.CreateWorktree(ctx, rc, filepath.Join(a.cfg.WorkDir, "worktrees"), task.ID, task.Branch)
+	if err != nil {
+		if shutdown() {
+			return
+		}
+		a.tasks.setStatus(task.ID, model.StatusFailed)
+		msg := "⛔ 创建任务工作区失败: " + err.Error()
+		p.finish(ctx, report.ErrorCard(task, msg), msg)
+		return
+	}
+	a.tasks.setWorktree(task.ID, wt.Path, wt.Branch)
+	// cancelled reports whether the user aborted the task, as opposed to the
+	// whole runner shutting down.
+	cancelled := func() bool {
+		if runCtx.Err() == nil || ctx.Err() != nil {
+			return false
+		}
+		a.tasks.setStatus(task.ID, model.StatusCancelled)
+		a.cleanupWorktree(ctx, task.ID, wt, false, false)
+		p.cancelled(ctx)
+		return true
+	}
+
+	if rc.SetupCmd != "" {
+		if setupOut, err := a.runnerFor(rc).RunCommand(runCtx, wt.Path, rc.SetupCmd); err != nil {
+			if shutdown() || cancelled() {
+				return
+			}
+			a.tasks.setStatus(task.ID, model.StatusFailed)
+			a.cleanupWorktree(ctx, task.ID, wt, false, false)
+			msg := report.SetupFailed(rc.SetupCmd, err, setupOut)
+			p.finish(ctx, report.ErrorCard(task, msg), msg)
+			return
+		}
+		if shutdown() {
+			return
+		}
+	}
+
+	if len(task.Attachments) > 0 {
+		atts, notes := a.downloadAttachments(runCtx, task)
+		if len(notes) > 0 {
+			_ = sendText(ctx, a.feishu, task.ChatID, task.ReplyMessage, "⚠️ 部分附件下载失败，任务将在没有这些附件的情况下执行:\n"+strings.Join(notes, "\n"))
+		}
+		j.task.Attachments = atts
+	}
+
+	run, ok := a.execute(runCtx, j, wt.Path, out, func(status model.TaskStatus, repair int) {
+		if repair > 0 {
+			p.setAttempt(repair, a.cfg.RepairAttempts)
+		}
+		setStatus(status)
+	})
+	if shutdown() || !ok && cancelled() {
 		return
 	}
-	_ = a.feishu.SendText(ctx, msg.ChatID, report.Accepted(task))
+	run.AgentVersion = a.versions.get(ctx, j.agent)
+
+	setStatus(model.StatusDiffing)
+	if err := repo.IncludeUntracked(ctx, wt.Path); err != nil {
+		log.Printf("task %s: %v", task.ID, err)
+	}
+	ds := repo.DiffStat(ctx, wt.Path)
+	diff := repo.DiffSnippet(ctx, wt.Path, 120)
+	if err := repo.WritePatch(ctx, wt.Path, a.patchPath(task.ID)); err != nil {
+		log.Printf("task %s: write patch: %v", task.ID, err)
+	}
+	succeeded := run.ExitErr == nil && run.TestErr == nil && run.LintErr == nil
+	if succeeded && rc.AutoCommit {
+		a.commitResult(ctx, task, rc, wt, &run)
+		succeeded = run.CommitErr == nil
+	}
+	if run.PushBranch != "" && rc.CodeHost != "" {
+		a.openPullRequest(ctx, task, rc, &run, ds)
+	}
+	run.Branch = wt.Branch
+	// A commit that was not pushed only exists on the local task branch.
+	keepBranch := run.CommitSHA != "" && run.PushBranch == ""
+	if !a.cleanupWorktree(ctx, task.ID, wt, succeeded, keepBranch) {
+		run.Worktree = wt.Path
+	}
+	if a.cfg.UploadArtifacts {
+		run.Uploaded = a.uploadArtifacts(ctx, task, run)
+	}
+	a.tasks.setResult(task.ID, run, ds)
+	if succeeded {
+		a.tasks.setStatus(task.ID, model.StatusSucceeded)
+	} else {
+		a.tasks.setStatus(task.ID, model.StatusFailed)
+	}
+	p.finish(ctx, report.FinalCard(task, run, ds, diff), report.Final(task, run, ds, diff))
+}
+
+// patchPath is where a task's full diff is saved for /diff.
+func (a *App) patchPath(taskID string) string {
+	return filepath.Join(a.codex.WorkDir, fmt.Sprintf("task-%s.patch", taskID))
+}
+
+// execute runs the agent and then the tests in dir. While the tests fail and
+// the repair policy allows, the agent is re-run with the failing output.
+// onPhase is called as each run or test starts, with the repair number (0
+// for the original run). ok is false when ctx ended before it finished.
+func (a *App) execute(ctx context.Context, j *job, dir string, out *codex.Output, onPhase func(status model.TaskStatus, repair int)) (run codex.Result, ok bool) {
+	started := time.Now()
+	runner := a.runnerFor(j.repo)
+	bctx, cancel := a.budgetContext(ctx, started)
+	defer cancel()
+	attempt := func(t model.Task, repair int) codex.Result {
+		onPhase(model.StatusRunning, repair)
+		r := runner.Execute(bctx, j.agent, t, dir, out)
+		if ctx.Err() != nil {
+			return r
+		}
+		onPhase(model.StatusTesting, repair)
+		r.TestOutput, r.Tests, r.TestErr = runner.RunTests(bctx, j.task, dir)
+		r.TestLogPath = runner.TestLogPath(j.task.ID)
+		if j.repo.LintCmd != "" && bctx.Err() == nil {
+			r.LintOutput, r.LintErr = runner.RunCommand(bctx, dir, j.repo.LintCmd)
+		}
+		return r
+	}
+	run = attempt(j.task, 0)
+	run.Attempts = []codex.Attempt{attemptOf(1, run)}
+	for n := 1; ctx.Err() == nil && a.shouldRepair(run, n, started); n++ {
+		next := attempt(codex.RepairTask(j.task, n, run, j.repo.LintCmd), n)
+		run = run.Continue(next)
+		run.Attempts = append(run.Attempts, attemptOf(n+1, next))
+	}
+	return run, ctx.Err() == nil
+}
+
+// shouldRepair reports whether the agent should get another try after run:
+// the agent itself succeeded but the tests or lint failed, and neither the
+// attempt limit nor the time budget is used up. n is the number of repairs
+// so far plus one.
+func (a *App) shouldRepair(run codex.Result, n int, started time.Time) bool {
+	if run.ExitErr != nil || run.TestErr == nil && run.LintErr == nil || n > a.cfg.RepairAttempts {
+		return false
+	}
+	return a.cfg.RepairBudget == 0 || time.Since(started) < a.cfg.RepairBudget
+}
+
+// budgetContext bounds the agent, test and lint runs of all attempts,
+// including the first, by the time budget.
+func (a *App) budgetContext(ctx context.Context, started time.Time) (context.Context, context.CancelFunc) {
+	if a.cfg.RepairBudget == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, started.Add(a.cfg.RepairBudget))
+}
+
+func attemptOf(n int, run codex.Result) codex.Attempt {
+	return codex.Attempt{Number: n, Duration: run.Duration, ExitErr: run.ExitErr, TestErr: run.TestErr, LintErr: run.LintErr}
+}
+
+// restrictPublishing drops the push and PR steps of the repo's commit policy
+// that subj lacks permission for, explaining each in a note.
+func restrictPublishing(policy *access.Policy, subj access.Subject, rc config.RepoConfig) (config.RepoConfig, []string) {
+	var notes []string
+	if !rc.AutoCommit || rc.PushRemote == "" {
+		return rc, nil
+	}
+	if err := policy.Check(subj, rc.Name, config.PermPush); err != nil {
+		notes = append(notes, err.Error()+"，改动只提交到本地任务分支")
+		rc.PushRemote = ""
+	}
+	if rc.PushRemote != "" && rc.CodeHost != "" {
+		if err := policy.Check(subj, rc.Name, config.PermPR); err != nil {
+			notes = append(notes, err.Error()+"，推送后不会创建 PR")
+			rc.CodeHost = ""
+		}
+	}
+	return rc, notes
+}
+
+// runnerFor applies the repo's timeout, environment and prompt preamble.
+func (a *App) runnerFor(rc config.RepoConfig) codex.Runner {
+	r := a.codex
+	if rc.Timeout > 0 {
+		r.Timeout = rc.Timeout
+	}
+	keys := make([]string, 0, len(rc.Env))
+	for k := range rc.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r.Env = append(r.Env, k+"="+rc.Env[k])
+	}
+	r.Preamble = rc.PromptPreamble
+	return r
+}
+
+func parseOptions(cfg config.Runtime, repos []config.RepoConfig) parser.ParseOptions {
+	opts := parser.ParseOptions{DefaultTestCmd: cfg.DefaultTestCmd, RepoTestCmds: map[string]string{}}
+	for _, rc := range repos {
+		if rc.TestCmd != "" {
+			opts.RepoTestCmds[rc.Name] = rc.TestCmd
+		}
+	}
+	return opts
+}
 
-	rc, err := a.repoMgr.Resolve(task.Repo)
+// commitResult commits the task's changes and pushes them when the repo
+// policy names a remote. Failures are recorded on run.CommitErr.
+func (a *App) commitResult(ctx context.Context, task model.Task, rc config.RepoConfig, wt repo.Worktree, run *codex.Result) {
+	sha, err := repo.CommitAll(ctx, wt.Path, report.CommitMessage(task))
 	if err != nil {
-		_ = a.feishu.SendText(ctx, msg.ChatID, "⛔ Repo 校验失败: "+err.Error())
+		run.CommitErr = err
+		return
+	}
+	if sha == "" {
+		return
+	}
+	run.CommitSHA = sha
+	if rc.PushRemote == "" {
 		return
 	}
-	if err := repo.EnsureCleanAndCheckout(ctx, rc, task.Branch); err != nil {
-		_ = a.feishu.SendText(ctx, msg.ChatID, "⛔ Repo 状态不满足执行条件: "+err.Error())
+	branch := rc.PushBranchPrefix + task.ID
+	if err := repo.Push(ctx, wt.Path, rc.PushRemote, branch); err != nil {
+		run.CommitErr = err
 		return
 	}
+	run.PushBranch = rc.PushRemote + "/" + branch
+}
 
-	run := a.codex.Execute(ctx, task, rc.LocalPath)
-	tout, terr := a.codex.RunTests(ctx, task, rc.LocalPath)
-	run.TestOutput, run.TestErr = tout, terr
-	ds := repo.DiffStat(ctx, rc.LocalPath)
-	diff := repo.DiffSnippet(ctx, rc.LocalPath, 120)
-	_ = a.feishu.SendText(ctx, msg.ChatID, report.Final(task, run, ds, diff))
+// openPullRequest opens a pull/merge request from the pushed task branch
+// into the repo's default branch.
+func (a *App) openPullRequest(ctx context.Context, task model.Task, rc config.RepoConfig, run *codex.Result, diffStat string) {
+	if rc.DefaultBranch == "" {
+		run.PullRequestErr = fmt.Errorf("repo %s has no default_branch to target", rc.Name)
+		return
+	}
+	provider, err := codehost.New(rc.CodeHost, rc.CodeHostURL, rc.CodeHostProject, os.Getenv(rc.CodeHostTokenEnv))
+	if err != nil {
+		run.PullRequestErr = err
+		return
+	}
+	title := strings.SplitN(report.CommitMessage(task), "\n", 2)[0]
+	run.PullRequestURL, run.PullRequestErr = provider.CreatePullRequest(ctx, codehost.PullRequest{
+		Title: title,
+		Body:  report.PullRequestBody(task, *run, diffStat),
+		Head:  rc.PushBranchPrefix + task.ID,
+		Base:  rc.DefaultBranch,
+	})
+}
+
+// cleanupWorktree applies the configured cleanup policy and reports whether
+// the worktree was removed. The task's attachments go with it.
+func (a *App) cleanupWorktree(ctx context.Context, taskID string, wt repo.Worktree, succeeded, keepBranch bool) bool {
+	switch a.cfg.WorktreeCleanup {
+	case config.CleanupNever:
+		return false
+	case config.CleanupOnSuccess:
+		if !succeeded {
+			return false
+		}
+	}
+	if err := wt.Remove(ctx, keepBranch); err != nil {
+		log.Printf("remove worktree %s: %v", wt.Path, err)
+		return false
+	}
+	a.removeAttachments(taskID)
+	return true
 }
 
 func makeTaskID(seed string) string {
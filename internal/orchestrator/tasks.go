@@ -0,0 +1,132 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"feishu-codex-runner/internal/codex"
+	"feishu-codex-runner/internal/model"
+	"feishu-codex-runner/internal/report"
+	"feishu-codex-runner/internal/store"
+)
+
+// latestLinesShown is how much live Codex output /status and the status
+// card show.
+const latestLinesShown = 8
+
+var activeStatuses = []model.TaskStatus{
+	model.StatusQueued, model.StatusPreparing, model.StatusRunning, model.StatusTesting, model.StatusDiffing,
+}
+
+var finishedStatuses = []model.TaskStatus{
+	model.StatusSucceeded, model.StatusFailed, model.StatusCancelled,
+}
+
+// taskRegistry records task history in the durable task store and keeps the
+// cancel functions and live output of running tasks so chat commands can
+// control and inspect them.
+type taskRegistry struct {
+	store *store.TaskStore
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	outputs map[string]*codex.Output
+}
+
+func newTaskRegistry(st *store.TaskStore) *taskRegistry {
+	return &taskRegistry{store: st, cancels: map[string]context.CancelFunc{}, outputs: map[string]*codex.Output{}}
+}
+
+func (r *taskRegistry) add(task model.Task) {
+	if err := r.store.Create(task); err != nil {
+		log.Printf("task %s: record: %v", task.ID, err)
+	}
+}
+
+func (r *taskRegistry) setStatus(id string, status model.TaskStatus) {
+	if err := r.store.SetStatus(id, status); err != nil {
+		log.Printf("task %s: record status %s: %v", id, status, err)
+	}
+	if status.Terminal() {
+		r.mu.Lock()
+		delete(r.cancels, id)
+		delete(r.outputs, id)
+		r.mu.Unlock()
+	}
+}
+
+func (r *taskRegistry) setWorktree(id, path, branch string) {
+	if err := r.store.SetWorktree(id, path, branch); err != nil {
+		log.Printf("task %s: record worktree: %v", id, err)
+	}
+}
+
+// seenMessage reports whether a task was already created from msgID, which
+// happens when messages are redelivered after a restart.
+func (r *taskRegistry) seenMessage(msgID string) bool {
+	return len(r.store.Query(store.TaskFilter{MessageID: msgID, Limit: 1})) > 0
+}
+
+func (r *taskRegistry) setResult(id string, run codex.Result, diffStat string) {
+	if err := r.store.SetResult(id, store.NewResultRecord(run, diffStat)); err != nil {
+		log.Printf("task %s: record result: %v", id, err)
+	}
+}
+
+// setCancel registers the function that aborts a running task.
+func (r *taskRegistry) setCancel(id string, cancel context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancels[id] = cancel
+}
+
+// cancel aborts a running task and returns whether it had a cancel function.
+func (r *taskRegistry) cancel(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.cancels[id]
+	if ok {
+		c()
+	}
+	return ok
+}
+
+// setOutput registers the live Codex output of a running task.
+func (r *taskRegistry) setOutput(id string, out *codex.Output) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outputs[id] = out
+}
+
+// get returns the task's view, including its latest output while it runs.
+func (r *taskRegistry) get(id string) (report.TaskView, bool) {
+	rec, ok := r.store.Get(id)
+	if !ok {
+		return report.TaskView{}, false
+	}
+	v := viewOf(rec)
+	r.mu.Lock()
+	if out, ok := r.outputs[id]; ok {
+		v.Latest = out.Tail(latestLinesShown)
+	}
+	r.mu.Unlock()
+	return v, true
+}
+
+// forRequester lists the requester's active tasks followed by their most
+// recently finished ones, newest first.
+func (r *taskRegistry) forRequester(openID string, recent int) []report.TaskView {
+	var out []report.TaskView
+	for _, rec := range r.store.Query(store.TaskFilter{RequesterID: openID, Statuses: activeStatuses}) {
+		out = append(out, viewOf(rec))
+	}
+	for _, rec := range r.store.Query(store.TaskFilter{RequesterID: openID, Statuses: finishedStatuses, Limit: recent}) {
+		out = append(out, viewOf(rec))
+	}
+	return out
+}
+
+func viewOf(rec store.TaskRecord) report.TaskView {
+	return report.TaskView{Task: rec.Task, Status: rec.Status, UpdatedAt: rec.UpdatedAt}
+}
@@ -0,0 +1,46 @@
+package orchestrator
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"feishu-codex-runner/internal/model"
+	"feishu-codex-runner/internal/store"
+)
+
+func TestTaskRegistryLifecycle(t *testing.T) {
+	st, err := store.OpenTaskStore(filepath.Join(t.TempDir(), "tasks.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	r := newTaskRegistry(st)
+	now := time.Now()
+	r.add(model.Task{ID: "old", RequesterID: "u1", ReceivedAt: now.Add(-time.Hour)})
+	time.Sleep(time.Millisecond)
+	r.add(model.Task{ID: "new", RequesterID: "u1", ReceivedAt: now})
+	r.add(model.Task{ID: "other", RequesterID: "u2", ReceivedAt: now})
+
+	cancelled := false
+	r.setCancel("new", func() { cancelled = true })
+	r.setStatus("new", model.StatusRunning)
+	r.setStatus("old", model.StatusSucceeded)
+	// Terminal statuses are final.
+	r.setStatus("old", model.StatusRunning)
+
+	if v, _ := r.get("old"); v.Status != model.StatusSucceeded {
+		t.Fatalf("terminal status overwritten: %s", v.Status)
+	}
+	if !r.cancel("new") || !cancelled {
+		t.Fatal("expected running task to be cancellable")
+	}
+	if r.cancel("old") {
+		t.Fatal("finished task must not be cancellable")
+	}
+
+	views := r.forRequester("u1", 10)
+	if len(views) != 2 || views[0].Task.ID != "new" || views[1].Task.ID != "old" {
+		t.Fatalf("unexpected list: %+v", views)
+	}
+}
@@ -0,0 +1,43 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Control commands accepted alongside task instructions.
+const (
+	CmdStatus = "status"
+	CmdCancel = "cancel"
+	CmdRetry  = "retry"
+	CmdList   = "list"
+	CmdDiff   = "diff"
+	CmdReload = "reload"
+)
+
+// Command is a task control command such as "/cancel <task_id>".
+type Command struct {
+	Name   string
+	TaskID string
+}
+
+// ParseCommand recognizes control commands. ok is false when text is an
+// ordinary instruction (including ones that merely start with a slash, such
+// as "/healthz 返回 503"), which should go through ParseMessage instead.
+func ParseCommand(text string) (cmd Command, ok bool, err error) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return Command{}, false, nil
+	}
+	name := strings.ToLower(strings.TrimPrefix(fields[0], "/"))
+	switch name {
+	case CmdList, CmdReload:
+		return Command{Name: name}, true, nil
+	case CmdStatus, CmdCancel, CmdRetry, CmdDiff:
+		if len(fields) < 2 {
+			return Command{}, true, fmt.Errorf("/%s requires a task_id", name)
+		}
+		return Command{Name: name, TaskID: strings.TrimPrefix(fields[1], "task_id=")}, true, nil
+	}
+	return Command{}, false, nil
+}
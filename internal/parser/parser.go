@@ -3,17 +3,26 @@ package parser
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 
+	"feishu-codex-runner/internal/codex"
 	"feishu-codex-runner/internal/model"
 )
 
 var kvPattern = regexp.MustCompile(`#([a-zA-Z_]+)=(("[^"]+")|([^\s]+))`)
 
+// codeFence matches a ``` fenced block, unterminated ones running to the end.
+var codeFence = regexp.MustCompile("(?s)```.*?(```|$)")
+
 type ParseOptions struct {
 	DefaultRepo    string
 	DefaultTestCmd string
+	// RepoTestCmds are per-repo default test commands by repo name; they
+	// take precedence over DefaultTestCmd.
+	RepoTestCmds map[string]string
 }
 
 func ParseMessage(msg model.Message, opts ParseOptions) (model.Task, error) {
@@ -23,7 +32,6 @@ func ParseMessage(msg model.Message, opts ParseOptions) (model.Task, error) {
 	}
 	task := model.Task{
 		Repo:        opts.DefaultRepo,
-		TestCmd:     opts.DefaultTestCmd,
 		Mode:        "implement",
 		Instruction: text,
 		RequesterID: msg.SenderOpenID,
@@ -35,15 +43,20 @@ func ParseMessage(msg model.Message, opts ParseOptions) (model.Task, error) {
 
 	if strings.HasPrefix(text, "{") {
 		if err := parseJSON(text, &task); err == nil {
-			return finalize(task)
+			return finalize(task, opts)
 		}
 	}
 
-	matches := kvPattern.FindAllStringSubmatch(text, -1)
-	cleaned := text
-	for _, m := range matches {
-		k := strings.ToLower(m[1])
-		v := strings.Trim(m[2], `"`)
+	// Flags inside fenced code blocks are part of pasted code, not options.
+	code := codeFence.FindAllStringIndex(text, -1)
+	var cleaned strings.Builder
+	last := 0
+	for _, m := range kvPattern.FindAllStringSubmatchIndex(text, -1) {
+		if inSpans(m[0], code) {
+			continue
+		}
+		k := strings.ToLower(text[m[2]:m[3]])
+		v := strings.Trim(text[m[4]:m[5]], `"`)
 		switch k {
 		case "repo":
 			task.Repo = v
@@ -53,11 +66,24 @@ func ParseMessage(msg model.Message, opts ParseOptions) (model.Task, error) {
 			task.TestCmd = v
 		case "mode":
 			task.Mode = v
+		case "agent":
+			task.Agent = strings.ToLower(v)
+		}
+		cleaned.WriteString(text[last:m[0]])
+		last = m[1]
+	}
+	cleaned.WriteString(text[last:])
+	task.Instruction = strings.TrimSpace(cleaned.String())
+	return finalize(task, opts)
+}
+
+func inSpans(i int, spans [][]int) bool {
+	for _, sp := range spans {
+		if i >= sp[0] && i < sp[1] {
+			return true
 		}
-		cleaned = strings.Replace(cleaned, m[0], "", 1)
 	}
-	task.Instruction = strings.TrimSpace(cleaned)
-	return finalize(task)
+	return false
 }
 
 func parseJSON(text string, task *model.Task) error {
@@ -66,6 +92,7 @@ func parseJSON(text string, task *model.Task) error {
 		Branch      string `json:"branch"`
 		TestCmd     string `json:"test_cmd"`
 		Mode        string `json:"mode"`
+		Agent       string `json:"agent"`
 		Task        string `json:"task"`
 		Instruction string `json:"instruction"`
 	}
@@ -84,6 +111,9 @@ func parseJSON(text string, task *model.Task) error {
 	if payload.Mode != "" {
 		task.Mode = payload.Mode
 	}
+	if payload.Agent != "" {
+		task.Agent = strings.ToLower(payload.Agent)
+	}
 	if payload.Task != "" {
 		task.Instruction = payload.Task
 	}
@@ -93,16 +123,25 @@ func parseJSON(text string, task *model.Task) error {
 	return nil
 }
 
-func finalize(task model.Task) (model.Task, error) {
+func finalize(task model.Task, opts ParseOptions) (model.Task, error) {
 	if task.Repo == "" {
 		return model.Task{}, errors.New("repo is required")
 	}
+	if task.TestCmd == "" {
+		task.TestCmd = opts.RepoTestCmds[task.Repo]
+	}
+	if task.TestCmd == "" {
+		task.TestCmd = opts.DefaultTestCmd
+	}
 	if task.TestCmd == "" {
 		task.TestCmd = "go test ./..."
 	}
 	if task.Mode == "" {
 		task.Mode = "implement"
 	}
+	if task.Agent != "" && !slices.Contains(codex.Agents, task.Agent) {
+		return model.Task{}, fmt.Errorf("unknown agent %q (supported: %s)", task.Agent, strings.Join(codex.Agents, ", "))
+	}
 	if task.Instruction == "" {
 		return model.Task{}, errors.New("instruction is required")
 	}
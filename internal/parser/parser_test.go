@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -18,6 +19,20 @@ func TestParseMessageFlags(t *testing.T) {
 	}
 }
 
+func TestParseMessageAgent(t *testing.T) {
+	task, err := ParseMessage(model.Message{Text: "#repo=aoi #agent=Claude add jwt middleware"}, ParseOptions{})
+	if err != nil || task.Agent != "claude" || task.Instruction != "add jwt middleware" {
+		t.Fatalf("agent = %q, instruction = %q, err = %v", task.Agent, task.Instruction, err)
+	}
+	task, err = ParseMessage(model.Message{Text: `{"repo":"aoi","task":"fix","agent":"AIDER"}`}, ParseOptions{})
+	if err != nil || task.Agent != "aider" {
+		t.Fatalf("json agent = %q, err = %v", task.Agent, err)
+	}
+	if _, err := ParseMessage(model.Message{Text: "#repo=aoi #agent=copilot fix"}, ParseOptions{}); err == nil || !strings.Contains(err.Error(), `unknown agent "copilot"`) {
+		t.Fatalf("want unknown agent error, got %v", err)
+	}
+}
+
 func TestParseMessageJSON(t *testing.T) {
 	msg := model.Message{MessageID: "m1", ChatID: "c1", SenderOpenID: "u1", CreateTime: time.Now(), Text: `{"repo":"aoi-service","task":"fix healthz","test_cmd":"go test ./..."}`}
 	task, err := ParseMessage(msg, ParseOptions{})
@@ -28,3 +43,51 @@ func TestParseMessageJSON(t *testing.T) {
 		t.Fatalf("unexpected task: %+v", task)
 	}
 }
+
+func TestParseMessageRepoTestCmd(t *testing.T) {
+	opts := ParseOptions{DefaultTestCmd: "go test ./...", RepoTestCmds: map[string]string{"web": "npm test"}}
+	for text, want := range map[string]string{
+		"#repo=web fix login":                  "npm test",
+		"#repo=web #test_cmd=\"make e2e\" fix": "make e2e",
+		"#repo=api fix login":                  "go test ./...",
+	} {
+		task, err := ParseMessage(model.Message{Text: text}, opts)
+		if err != nil || task.TestCmd != want {
+			t.Errorf("%s: test cmd = %q (err %v), want %q", text, task.TestCmd, err, want)
+		}
+	}
+}
+
+func TestParseMessageKeepsCodeBlocks(t *testing.T) {
+	text := "#repo=aoi 修复下面的 panic\n```go\n// #branch=main is not a flag here\nfunc main() {\n\tpanic(\"boom\")\n}\n```\n#branch=fix/panic"
+	task, err := ParseMessage(model.Message{Text: text}, ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "修复下面的 panic\n```go\n// #branch=main is not a flag here\nfunc main() {\n\tpanic(\"boom\")\n}\n```"
+	if task.Branch != "fix/panic" || task.Instruction != want {
+		t.Fatalf("branch=%q instruction=%q", task.Branch, task.Instruction)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	cmd, ok, err := ParseCommand("/cancel task_id=abc123")
+	if err != nil || !ok || cmd.Name != CmdCancel || cmd.TaskID != "abc123" {
+		t.Fatalf("unexpected command: %+v ok=%v err=%v", cmd, ok, err)
+	}
+	if cmd, ok, _ := ParseCommand("/LIST"); !ok || cmd.Name != CmdList {
+		t.Fatalf("unexpected list command: %+v ok=%v", cmd, ok)
+	}
+	if cmd, ok, _ := ParseCommand("/diff 0a1b2c"); !ok || cmd.Name != CmdDiff || cmd.TaskID != "0a1b2c" {
+		t.Fatalf("unexpected diff command: %+v ok=%v", cmd, ok)
+	}
+	if cmd, ok, err := ParseCommand("/reload"); err != nil || !ok || cmd.Name != CmdReload {
+		t.Fatalf("unexpected reload command: %+v ok=%v err=%v", cmd, ok, err)
+	}
+	if _, ok, err := ParseCommand("/retry"); !ok || err == nil {
+		t.Fatalf("expected missing task_id error, ok=%v err=%v", ok, err)
+	}
+	if _, ok, _ := ParseCommand("/healthz 在 Redis 不可用时返回 503 #repo=aoi"); ok {
+		t.Fatal("instruction starting with a path must not be treated as a command")
+	}
+}
@@ -0,0 +1,39 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Identity used for commits when the repository has no user configured.
+const (
+	fallbackAuthorName  = "feishu-codex-runner"
+	fallbackAuthorEmail = "codex-runner@localhost"
+)
+
+// CommitAll stages every change in the worktree at path and commits it with
+// message. It returns an empty SHA when there is nothing to commit.
+func CommitAll(ctx context.Context, path, message string) (string, error) {
+	if _, err := runGit(ctx, path, "add", "--all"); err != nil {
+		return "", err
+	}
+	if out, err := runGit(ctx, path, "status", "--porcelain"); err != nil || strings.TrimSpace(out) == "" {
+		return "", err
+	}
+	args := []string{"commit", "--quiet", "--file", "-"}
+	if email, _ := runGit(ctx, path, "config", "user.email"); strings.TrimSpace(email) == "" {
+		args = append([]string{"-c", "user.name=" + fallbackAuthorName, "-c", "user.email=" + fallbackAuthorEmail}, args...)
+	}
+	if _, err := runGitCmd(ctx, 30*time.Second, path, message, args...); err != nil {
+		return "", err
+	}
+	sha, err := runGit(ctx, path, "rev-parse", "HEAD")
+	return strings.TrimSpace(sha), err
+}
+
+// Push publishes HEAD of the worktree at path to branch on remote.
+func Push(ctx context.Context, path, remote, branch string) error {
+	_, err := runGitCmd(ctx, 5*time.Minute, path, "", "push", remote, "HEAD:refs/heads/"+branch)
+	return err
+}
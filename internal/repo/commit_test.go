@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommitAllAndPushToBareRemote(t *testing.T) {
+	ctx := context.Background()
+	rc := initRepo(t)
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if _, err := runGit(ctx, rc.LocalPath, "init", "--bare", "-q", remote); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(ctx, rc.LocalPath, "remote", "add", "origin", remote); err != nil {
+		t.Fatal(err)
+	}
+	wt, err := CreateWorktree(ctx, rc, t.TempDir(), "t1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha, err := CommitAll(ctx, wt.Path, "codex: nothing\n")
+	if err != nil || sha != "" {
+		t.Fatalf("clean worktree should not commit: sha=%q err=%v", sha, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(wt.Path, "feature.go"), []byte("package demo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sha, err = CommitAll(ctx, wt.Path, "codex: add feature\n\nTask-ID: t1\n")
+	if err != nil || sha == "" {
+		t.Fatalf("commit: sha=%q err=%v", sha, err)
+	}
+	msg, _ := runGit(ctx, wt.Path, "log", "-1", "--format=%B")
+	if !strings.Contains(msg, "Task-ID: t1") {
+		t.Fatalf("unexpected commit message: %q", msg)
+	}
+
+	if err := Push(ctx, wt.Path, "origin", "codex/t1"); err != nil {
+		t.Fatal(err)
+	}
+	pushed, err := runGit(ctx, remote, "rev-parse", "refs/heads/codex/t1")
+	if err != nil || strings.TrimSpace(pushed) != sha {
+		t.Fatalf("remote branch at %q, want %s (err=%v)", pushed, sha, err)
+	}
+}
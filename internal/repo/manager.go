@@ -2,9 +2,10 @@ package repo
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path"
 	"strings"
 	"time"
 
@@ -34,43 +35,35 @@ func (m *Manager) Resolve(name string) (config.RepoConfig, error) {
 	return r, nil
 }
 
-func EnsureCleanAndCheckout(ctx context.Context, repo config.RepoConfig, branch string) error {
-	if err := ensureClean(ctx, repo.LocalPath); err != nil {
-		return err
-	}
-	target := strings.TrimSpace(branch)
-	if target == "" {
-		target = strings.TrimSpace(repo.DefaultBranch)
-	}
-	if target == "" {
-		return nil
-	}
-	_, err := runGit(ctx, repo.LocalPath, "checkout", target)
-	if err == nil {
+// CheckBranch rejects a task branch that matches none of the repo's
+// allowed_branches patterns. An empty branch (the default branch) and a
+// repo without patterns allow anything.
+func CheckBranch(rc config.RepoConfig, branch string) error {
+	branch = strings.TrimSpace(branch)
+	if branch == "" || len(rc.AllowedBranches) == 0 {
 		return nil
 	}
-	if strings.Contains(err.Error(), "did not match") || strings.Contains(err.Error(), "pathspec") {
-		_, err = runGit(ctx, repo.LocalPath, "checkout", "-b", target)
+	for _, pat := range rc.AllowedBranches {
+		if ok, _ := path.Match(pat, branch); ok {
+			return nil
+		}
 	}
-	return err
+	return fmt.Errorf("branch %s not allowed in repo %s (allowed: %s)", branch, rc.Name, strings.Join(rc.AllowedBranches, ", "))
 }
 
-func ensureClean(ctx context.Context, path string) error {
-	out, err := runGit(ctx, path, "status", "--porcelain")
-	if err != nil {
-		return err
-	}
-	if strings.TrimSpace(out) != "" {
-		return errors.New("repository has uncommitted changes; refusing to run")
-	}
-	return nil
+func runGit(ctx context.Context, workdir string, args ...string) (string, error) {
+	return runGitCmd(ctx, 30*time.Second, workdir, "", args...)
 }
 
-func runGit(ctx context.Context, workdir string, args ...string) (string, error) {
-	cctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+// runGitCmd runs git with an explicit timeout and optional stdin.
+func runGitCmd(ctx context.Context, timeout time.Duration, workdir, stdin string, args ...string) (string, error) {
+	cctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	cmd := exec.CommandContext(cctx, "git", args...)
 	cmd.Dir = workdir
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return string(out), fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, string(out))
@@ -100,3 +93,12 @@ func DiffSnippet(ctx context.Context, path string, maxLines int) string {
 	}
 	return strings.Join(lines[:maxLines], "\n") + "\n... (truncated)"
 }
+
+// WritePatch saves the complete diff of the working tree at path to dest.
+func WritePatch(ctx context.Context, path, dest string) error {
+	out, err := runGit(ctx, path, "diff", "--binary")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dest, []byte(out), 0o644)
+}
@@ -0,0 +1,19 @@
+package repo
+
+import (
+	"testing"
+
+	"feishu-codex-runner/internal/config"
+)
+
+func TestCheckBranch(t *testing.T) {
+	rc := config.RepoConfig{Name: "aoi", AllowedBranches: []string{"feat/*", "fix/*"}}
+	for branch, ok := range map[string]bool{"": true, "feat/jwt": true, "fix/healthz": true, "main": false, "feat/a/b": false} {
+		if err := CheckBranch(rc, branch); (err == nil) != ok {
+			t.Errorf("CheckBranch(%q) = %v, want allowed=%v", branch, err, ok)
+		}
+	}
+	if err := CheckBranch(config.RepoConfig{Name: "open"}, "main"); err != nil {
+		t.Errorf("repo without patterns should allow any branch: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"feishu-codex-runner/internal/config"
+)
+
+// Worktree is an isolated checkout created for a single task, so tasks never
+// modify the primary checkout at LocalPath.
+type Worktree struct {
+	Path     string
+	Branch   string
+	Base     string
+	repoPath string
+}
+
+// CreateWorktree adds a git worktree for taskID under root. When branch names
+// an existing ref the worktree gets a fresh codex/<task_id> branch from it;
+// a branch that does not exist yet is created from the default branch, the
+// same way a plain checkout -b would.
+func CreateWorktree(ctx context.Context, rc config.RepoConfig, root, taskID, branch string) (Worktree, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return Worktree{}, fmt.Errorf("create worktree root: %w", err)
+	}
+	// Drop bookkeeping for worktrees whose directories were deleted by hand.
+	_, _ = runGit(ctx, rc.LocalPath, "worktree", "prune")
+
+	wt := Worktree{
+		Path:     filepath.Join(root, rc.Name+"-"+taskID),
+		Branch:   "codex/" + taskID,
+		repoPath: rc.LocalPath,
+	}
+	branch = strings.TrimSpace(branch)
+	switch {
+	case branch != "" && refExists(ctx, rc.LocalPath, branch):
+		wt.Base = branch
+	case branch != "" && refExists(ctx, rc.LocalPath, "origin/"+branch):
+		wt.Base = "origin/" + branch
+	default:
+		if branch != "" {
+			wt.Branch = branch
+		}
+		wt.Base = strings.TrimSpace(rc.DefaultBranch)
+		if wt.Base == "" || !refExists(ctx, rc.LocalPath, wt.Base) {
+			wt.Base = "HEAD"
+		}
+	}
+	if _, err := runGit(ctx, rc.LocalPath, "worktree", "add", "-b", wt.Branch, wt.Path, wt.Base); err != nil {
+		return Worktree{}, err
+	}
+	return wt, nil
+}
+
+// OpenWorktree refers to a worktree created earlier, e.g. by a previous run
+// of the process, so it can be removed.
+func OpenWorktree(rc config.RepoConfig, path, branch string) Worktree {
+	return Worktree{Path: path, Branch: branch, repoPath: rc.LocalPath}
+}
+
+// Remove deletes the worktree directory and, unless keepBranch is set, its
+// task branch. Uncommitted changes in the worktree are discarded.
+func (w Worktree) Remove(ctx context.Context, keepBranch bool) error {
+	if _, err := runGit(ctx, w.repoPath, "worktree", "remove", "--force", w.Path); err != nil {
+		return err
+	}
+	if keepBranch {
+		return nil
+	}
+	_, err := runGit(ctx, w.repoPath, "branch", "-D", w.Branch)
+	return err
+}
+
+// IncludeUntracked marks new files as intent-to-add so DiffStat and
+// DiffSnippet report files the agent created, not only modified ones.
+func IncludeUntracked(ctx context.Context, path string) error {
+	_, err := runGit(ctx, path, "add", "--all", "--intent-to-add")
+	return err
+}
+
+func refExists(ctx context.Context, path, ref string) bool {
+	_, err := runGit(ctx, path, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return err == nil
+}
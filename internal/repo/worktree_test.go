@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"feishu-codex-runner/internal/config"
+)
+
+func initRepo(t *testing.T) config.RepoConfig {
+	t.Helper()
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"commit", "-q", "--allow-empty", "-m", "init"},
+		{"branch", "feat/existing"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	return config.RepoConfig{Name: "demo", LocalPath: dir, Allowed: true, DefaultBranch: "main"}
+}
+
+func currentBranch(t *testing.T, dir string) string {
+	t.Helper()
+	out, err := runGit(context.Background(), dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(out)
+}
+
+func TestCreateWorktreeLeavesPrimaryCheckoutAlone(t *testing.T) {
+	ctx := context.Background()
+	rc := initRepo(t)
+	root := t.TempDir()
+
+	cases := []struct {
+		taskID, branch, wantBranch, wantBase string
+	}{
+		{"t1", "", "codex/t1", "main"},
+		{"t2", "feat/existing", "codex/t2", "feat/existing"},
+		{"t3", "feat/new", "feat/new", "main"},
+	}
+	for _, tc := range cases {
+		wt, err := CreateWorktree(ctx, rc, root, tc.taskID, tc.branch)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.taskID, err)
+		}
+		if wt.Branch != tc.wantBranch || wt.Base != tc.wantBase {
+			t.Fatalf("%s: got branch=%s base=%s", tc.taskID, wt.Branch, wt.Base)
+		}
+		if got := currentBranch(t, wt.Path); got != tc.wantBranch {
+			t.Fatalf("%s: worktree on %s", tc.taskID, got)
+		}
+	}
+	if got := currentBranch(t, rc.LocalPath); got != "main" {
+		t.Fatalf("primary checkout switched to %s", got)
+	}
+}
+
+func TestWorktreeRemove(t *testing.T) {
+	ctx := context.Background()
+	rc := initRepo(t)
+	wt, err := CreateWorktree(ctx, rc, t.TempDir(), "t1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wt.Path, "new.txt"), []byte("x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := IncludeUntracked(ctx, wt.Path); err != nil {
+		t.Fatal(err)
+	}
+	if ds := DiffStat(ctx, wt.Path); !strings.Contains(ds, "new.txt") {
+		t.Fatalf("diff stat should include untracked file: %q", ds)
+	}
+	if err := wt.Remove(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+		t.Fatalf("worktree dir still present: %v", err)
+	}
+	if refExists(ctx, rc.LocalPath, wt.Branch) {
+		t.Fatalf("task branch %s not deleted", wt.Branch)
+	}
+}
@@ -0,0 +1,238 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"feishu-codex-runner/internal/codex"
+	"feishu-codex-runner/internal/model"
+	"feishu-codex-runner/internal/parser"
+)
+
+// progressPhases are the steps shown on the status card, in order.
+var progressPhases = []model.TaskStatus{
+	model.StatusQueued, model.StatusPreparing, model.StatusRunning, model.StatusTesting, model.StatusDiffing,
+}
+
+// Progress is what the status card shows about a task in flight.
+type Progress struct {
+	Status  model.TaskStatus
+	Elapsed time.Duration
+	// Position is the queue position while queued, 0 when unknown or
+	// already started.
+	Position int
+	// Latest holds the most recent agent output lines.
+	Latest []string
+	// Repair is the current repair attempt (0 for the original run) out of
+	// MaxRepairs.
+	Repair, MaxRepairs int
+}
+
+// ProgressCard is the status card that is edited in place while a task moves
+// through its phases.
+func ProgressCard(task model.Task, pr Progress) map[string]any {
+	status := pr.Status
+	title, template := statusLabel(status), "blue"
+	switch status {
+	case model.StatusCancelled:
+		template = "grey"
+	case model.StatusInterrupted:
+		template = "orange"
+	case model.StatusQueued:
+		if pr.Position > 0 {
+			title = fmt.Sprintf("%s（第 %d 位）", title, pr.Position)
+		}
+	}
+	if pr.Repair > 0 && !status.Terminal() {
+		title = fmt.Sprintf("%s · 修复 %d/%d", title, pr.Repair, pr.MaxRepairs)
+		template = "orange"
+	}
+	current := -1
+	for i, ph := range progressPhases {
+		if ph == status {
+			current = i
+		}
+	}
+	var steps []string
+	for i, ph := range progressPhases {
+		mark := "⬜"
+		switch {
+		case i < current:
+			mark = "✔️"
+		case i == current:
+			mark = "▶️"
+		}
+		steps = append(steps, mark+" "+statusLabel(ph))
+	}
+	elements := []any{
+		markdown(fmt.Sprintf("**repo**: %s　**branch**: %s　**已用时**: %s\n%s",
+			task.Repo, blankAs(task.Branch, "(default)"), pr.Elapsed.Round(time.Second), truncateRunes(task.Instruction, 200))),
+		markdown(strings.Join(steps, "\n")),
+	}
+	if len(pr.Latest) > 0 && !status.Terminal() {
+		elements = append(elements, panel("最新输出", strings.Join(pr.Latest, "\n"), true))
+	}
+	if !status.Terminal() {
+		elements = append(elements, button("取消任务", "danger", parser.CmdCancel, task.ID))
+	}
+	return card(title, task.ID, template, elements...)
+}
+
+// ErrorCard replaces the status card when a task fails before it produced
+// a result.
+func ErrorCard(task model.Task, message string) map[string]any {
+	return card("❌ 任务失败", task.ID, "red", markdown(message),
+		button("重试", "default", parser.CmdRetry, task.ID))
+}
+
+// FinalCard renders the task result as an interactive card: the header colour
+// reflects the outcome, long sections are collapsible and buttons allow a
+// retry or fetching the full diff.
+func FinalCard(task model.Task, run codex.Result, diffStat, diffSnippet string) map[string]any {
+	title, template := "✅ 任务成功", "green"
+	if run.ExitErr != nil || run.TestErr != nil || run.LintErr != nil || run.CommitErr != nil {
+		title, template = "❌ 任务失败", "red"
+	}
+	meta := []string{
+		fmt.Sprintf("**repo**: %s　**耗时**: %s", task.Repo, run.Duration.Round(1e9)),
+	}
+	if a := agentLabel(run); a != "" {
+		meta[0] += "　**agent**: " + a
+	}
+	if run.CommitSHA != "" {
+		commit := "**commit**: " + run.CommitSHA
+		if run.PushBranch != "" {
+			commit += "　**branch**: " + run.PushBranch
+		}
+		meta = append(meta, commit)
+	}
+	if run.PullRequestURL != "" {
+		meta = append(meta, fmt.Sprintf("**PR**: [%s](%s)", run.PullRequestURL, run.PullRequestURL))
+	}
+	if u := usageLine(run.Usage); u != "" {
+		meta = append(meta, u)
+	}
+	if len(run.Uploaded) > 0 {
+		meta = append(meta, "**完整日志与 diff**: 已作为文件发送（"+strings.Join(run.Uploaded, ", ")+"）")
+	} else if run.LogPath != "" {
+		meta = append(meta, "**完整日志**: "+run.LogPath)
+	}
+	if run.Worktree != "" {
+		meta = append(meta, fmt.Sprintf("**工作区已保留**: %s (branch=%s)", run.Worktree, run.Branch))
+	}
+	var errs []string
+	for _, e := range []struct {
+		label string
+		err   error
+	}{
+		{"Codex 执行错误", run.ExitErr},
+		{"测试错误", run.TestErr},
+		{"Lint 错误", run.LintErr},
+		{"提交/推送错误", run.CommitErr},
+		{"PR 创建失败", run.PullRequestErr},
+	} {
+		if e.err != nil {
+			errs = append(errs, fmt.Sprintf("**%s**: %s", e.label, e.err.Error()))
+		}
+	}
+	for _, e := range run.AgentErrors {
+		errs = append(errs, "**Codex 报错**: "+truncateRunes(e, 200))
+	}
+
+	elements := []any{markdown(strings.Join(meta, "\n"))}
+	if len(errs) > 0 {
+		elements = append(elements, markdown(strings.Join(errs, "\n")))
+	}
+	if run.FinalMessage != "" {
+		elements = append(elements, collapsible("Codex 最终回复", markdown(truncateLines(run.FinalMessage, 60)), true))
+		if len(run.Commands) > 0 {
+			elements = append(elements, panel(fmt.Sprintf("执行命令（%d）", len(run.Commands)), commandList(run.Commands), false))
+		}
+		if len(run.FilesChanged) > 0 {
+			elements = append(elements, panel(fmt.Sprintf("改动文件（%d）", len(run.FilesChanged)), fileList(run.FilesChanged), false))
+		}
+	} else {
+		elements = append(elements, panel("Codex 输出摘要", truncateLines(run.Output, 40), true))
+	}
+	elements = append(elements,
+		panel("Diff Stat", truncateLines(diffStat, 30), false),
+		panel("Diff 摘要", truncateLines(diffSnippet, 60), false),
+	)
+	if len(run.Attempts) > 1 {
+		elements = append(elements, collapsible(fmt.Sprintf("修复尝试（%d）", len(run.Attempts)), markdown(attemptList(run.Attempts)), true))
+	}
+	if run.Tests != nil {
+		elements = append(elements, panel("测试结果", testResult(run.Tests), run.TestErr != nil))
+	}
+	if run.TestOutput != "" {
+		elements = append(elements, panel("测试输出", truncateLines(run.TestOutput, 40), run.TestErr != nil && run.Tests == nil))
+	}
+	if run.LintOutput != "" {
+		elements = append(elements, panel("Lint 输出", truncateLines(run.LintOutput, 40), run.LintErr != nil))
+	}
+	elements = append(elements,
+		button("重试", "default", parser.CmdRetry, task.ID),
+		button("查看完整 Diff", "primary_text", parser.CmdDiff, task.ID),
+	)
+	return card(title, task.ID, template, elements...)
+}
+
+func card(title, taskID, template string, elements ...any) map[string]any {
+	return map[string]any{
+		"schema": "2.0",
+		"config": map[string]any{"update_multi": true},
+		"header": map[string]any{
+			"title":    plainText(title),
+			"subtitle": plainText("task_id=" + taskID),
+			"template": template,
+		},
+		"body": map[string]any{"elements": elements},
+	}
+}
+
+// panel is a collapsible section showing body as a code block.
+func panel(title, body string, expanded bool) map[string]any {
+	return collapsible(title, markdown(codeBlock(body)), expanded)
+}
+
+func collapsible(title string, content any, expanded bool) map[string]any {
+	return map[string]any{
+		"tag":      "collapsible_panel",
+		"expanded": expanded,
+		"header":   map[string]any{"title": markdown("**" + title + "**")},
+		"elements": []any{content},
+	}
+}
+
+// button renders a callback button. Its value names the chat command the
+// click maps to, so it is handled exactly like the typed command.
+func button(text, style, action, taskID string) map[string]any {
+	return map[string]any{
+		"tag":  "button",
+		"text": plainText(text),
+		"type": style,
+		"behaviors": []any{map[string]any{
+			"type":  "callback",
+			"value": map[string]string{"action": action, "task_id": taskID},
+		}},
+	}
+}
+
+func markdown(content string) map[string]any {
+	return map[string]any{"tag": "markdown", "content": content}
+}
+
+func plainText(content string) map[string]any {
+	return map[string]any{"tag": "plain_text", "content": content}
+}
+
+// codeBlock fences s, breaking up any fence inside it so agent output cannot
+// end the block early.
+func codeBlock(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		s = "(empty)"
+	}
+	return "```\n" + strings.ReplaceAll(s, "```", "`\u200b``") + "\n```"
+}
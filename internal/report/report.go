@@ -3,8 +3,10 @@ package report
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"feishu-codex-runner/internal/codex"
+	"feishu-codex-runner/internal/gotest"
 	"feishu-codex-runner/internal/model"
 )
 
@@ -12,33 +14,333 @@ func Accepted(task model.Task) string {
 	return fmt.Sprintf("✅ 任务已接收\ntask_id=%s\nrepo=%s branch=%s", task.ID, task.Repo, blankAs(task.Branch, "(default)"))
 }
 
+func Queued(task model.Task, position int) string {
+	return fmt.Sprintf("⏳ 任务排队中（第 %d 位），等待空闲 worker 或同仓库的任务完成\ntask_id=%s", position, task.ID)
+}
+
 func Final(task model.Task, run codex.Result, diffStat, diffSnippet string) string {
 	status := "✅ 成功"
-	if run.ExitErr != nil || run.TestErr != nil {
+	if run.ExitErr != nil || run.TestErr != nil || run.LintErr != nil || run.CommitErr != nil {
 		status = "❌ 失败"
 	}
 	parts := []string{status,
 		fmt.Sprintf("task_id=%s", task.ID),
 		fmt.Sprintf("耗时=%s", run.Duration.Round(1e9)),
-		"\n[Codex 输出摘要]\n" + truncateLines(run.Output, 40),
-		"\n[Diff Stat]\n" + truncateLines(diffStat, 30),
-		"\n[Diff 摘要]\n" + truncateLines(diffSnippet, 60),
 	}
-	if run.TestOutput != "" {
+	if a := agentLabel(run); a != "" {
+		parts = append(parts, "agent="+a)
+	}
+	if run.FinalMessage != "" {
+		parts = append(parts, "\n[Codex 最终回复]\n"+truncateLines(run.FinalMessage, 40))
+		if len(run.Commands) > 0 {
+			parts = append(parts, "\n[执行命令]\n"+commandList(run.Commands))
+		}
+		if len(run.FilesChanged) > 0 {
+			parts = append(parts, "\n[改动文件]\n"+fileList(run.FilesChanged))
+		}
+		if u := usageLine(run.Usage); u != "" {
+			parts = append(parts, u)
+		}
+	} else {
+		parts = append(parts, "\n[Codex 输出摘要]\n"+truncateLines(run.Output, 40))
+	}
+	parts = append(parts,
+		"\n[Diff Stat]\n"+truncateLines(diffStat, 30),
+		"\n[Diff 摘要]\n"+truncateLines(diffSnippet, 60),
+	)
+	if len(run.Attempts) > 1 {
+		parts = append(parts, "\n[修复尝试]\n"+attemptList(run.Attempts))
+	}
+	if run.Tests != nil {
+		parts = append(parts, "\n[测试结果]\n"+testResult(run.Tests))
+	} else if run.TestOutput != "" {
 		parts = append(parts, "\n[测试输出]\n"+truncateLines(run.TestOutput, 40))
 	}
-	if run.LogPath != "" {
+	if run.LintOutput != "" {
+		parts = append(parts, "\n[Lint 输出]\n"+truncateLines(run.LintOutput, 40))
+	}
+	if run.CommitSHA != "" {
+		commit := "\n[提交]\ncommit=" + run.CommitSHA
+		if run.PushBranch != "" {
+			commit += "\nbranch=" + run.PushBranch
+		}
+		if run.PullRequestURL != "" {
+			commit += "\nPR: " + run.PullRequestURL
+		}
+		parts = append(parts, commit)
+	}
+	if len(run.Uploaded) > 0 {
+		parts = append(parts, "\n完整日志与 diff 已作为文件发送: "+strings.Join(run.Uploaded, ", "))
+	} else if run.LogPath != "" {
 		parts = append(parts, "\n完整日志: "+run.LogPath)
 	}
+	if run.Worktree != "" {
+		parts = append(parts, fmt.Sprintf("工作区已保留: %s (branch=%s)", run.Worktree, run.Branch))
+	}
 	if run.ExitErr != nil {
 		parts = append(parts, "\nCodex 执行错误: "+run.ExitErr.Error())
 	}
+	for _, e := range run.AgentErrors {
+		parts = append(parts, "Codex 报错: "+truncateRunes(e, 200))
+	}
 	if run.TestErr != nil {
 		parts = append(parts, "\n测试错误: "+run.TestErr.Error())
 	}
+	if run.LintErr != nil {
+		parts = append(parts, "\nLint 错误: "+run.LintErr.Error())
+	}
+	if run.CommitErr != nil {
+		parts = append(parts, "\n提交/推送错误: "+run.CommitErr.Error())
+	}
+	if run.PullRequestErr != nil {
+		parts = append(parts, "\nPR 创建失败: "+run.PullRequestErr.Error())
+	}
 	return strings.Join(parts, "\n")
 }
 
+// SetupFailed reports a repo setup_cmd that failed before the agent ran.
+func SetupFailed(cmd string, err error, output string) string {
+	return fmt.Sprintf("⛔ 准备命令失败: %s\n%s\n\n[输出末尾]\n%s", cmd, err, lastLines(output, 30))
+}
+
+// ReloadChanges describes what a configuration reload changed.
+type ReloadChanges struct {
+	Added, Removed, Changed []string // repo names
+	Access                  bool     // access rules changed
+	Runtime                 bool     // runtime or policies changed; needs a restart
+}
+
+// Reloaded reports a successful configuration reload triggered by source.
+func Reloaded(source string, c ReloadChanges) string {
+	lines := []string{fmt.Sprintf("🔄 配置已重新加载（%s）", source)}
+	if len(c.Added)+len(c.Removed)+len(c.Changed) == 0 {
+		lines = append(lines, "仓库: 无变化")
+	}
+	if len(c.Added) > 0 {
+		lines = append(lines, "新增仓库: "+strings.Join(c.Added, ", "))
+	}
+	if len(c.Removed) > 0 {
+		lines = append(lines, "移除仓库: "+strings.Join(c.Removed, ", "))
+	}
+	if len(c.Changed) > 0 {
+		lines = append(lines, "变更仓库: "+strings.Join(c.Changed, ", "))
+	}
+	if c.Access {
+		lines = append(lines, "权限规则: 已更新")
+	} else {
+		lines = append(lines, "权限规则: 无变化")
+	}
+	if c.Runtime {
+		lines = append(lines, "⚠️ runtime/policies 配置有改动，需重启 runner 才能生效")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ReloadFailed reports a configuration reload that was rejected; the
+// previous configuration stays in effect.
+func ReloadFailed(source string, err error) string {
+	return fmt.Sprintf("⛔ 配置重新加载失败（%s），继续使用当前配置\n%s", source, err)
+}
+
+// CommitMessage builds the message for auto-committed task results: a
+// summary line from the instruction followed by task metadata trailers.
+func CommitMessage(task model.Task) string {
+	summary := strings.TrimSpace(strings.SplitN(strings.TrimSpace(task.Instruction), "\n", 2)[0])
+	return fmt.Sprintf("codex: %s\n\n%s\n\nTask-ID: %s\nRequested-By: %s\n",
+		truncateRunes(summary, 60), strings.TrimSpace(task.Instruction), task.ID, task.RequesterID)
+}
+
+// PullRequestBody describes a task's result for the pull/merge request: the
+// original instruction, the agent's summary and the test outcome.
+func PullRequestBody(task model.Task, run codex.Result, diffStat string) string {
+	testStatus := "通过"
+	if run.TestErr != nil {
+		testStatus = "失败: " + run.TestErr.Error()
+	}
+	if run.Tests != nil {
+		testStatus += "，" + run.Tests.Summary()
+	}
+	return fmt.Sprintf("由 feishu-codex-runner 自动创建。\n\n- Task ID: `%s`\n- 发起人: `%s`\n\n## 任务\n\n%s\n\n## Codex 摘要\n\n```\n%s\n```\n\n## Diff Stat\n\n```\n%s\n```\n\n## 测试（`%s`，%s）\n\n```\n%s\n```\n",
+		task.ID, task.RequesterID, strings.TrimSpace(task.Instruction),
+		truncateLines(summaryOf(run), 80), strings.TrimSpace(diffStat),
+		task.TestCmd, testStatus, truncateLines(run.TestOutput, 80))
+}
+
+// summaryOf is the agent's final answer when the JSON event stream provided
+// one, otherwise the head of its raw output.
+func summaryOf(run codex.Result) string {
+	if run.FinalMessage != "" {
+		return run.FinalMessage
+	}
+	return run.Output
+}
+
+func agentLabel(run codex.Result) string {
+	if run.AgentVersion != "" {
+		return fmt.Sprintf("%s (%s)", run.Agent, run.AgentVersion)
+	}
+	return run.Agent
+}
+
+// maxFailuresShown caps the failing tests listed with their log lines.
+const maxFailuresShown = 5
+
+// testResult is the parsed go test outcome: the summary line followed by
+// the first failures and their own log lines.
+func testResult(tests *gotest.Report) string {
+	parts := []string{tests.Summary()}
+	for i, f := range tests.Failures {
+		if i == maxFailuresShown {
+			parts = append(parts, fmt.Sprintf("... 另有 %d 个失败", len(tests.Failures)-i))
+			break
+		}
+		parts = append(parts, f.String())
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// maxCommandsListed caps the executed commands shown in a report.
+const maxCommandsListed = 15
+
+func commandList(cmds []codex.CommandRun) string {
+	var lines []string
+	for i, c := range cmds {
+		if i == maxCommandsListed {
+			lines = append(lines, fmt.Sprintf("... 另有 %d 条", len(cmds)-i))
+			break
+		}
+		mark := "✔"
+		if c.ExitCode != 0 {
+			mark = "✗"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s (exit %d)", mark, truncateRunes(c.Command, 100), c.ExitCode))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// attemptList summarizes each agent run of the repair loop.
+func attemptList(attempts []codex.Attempt) string {
+	lines := make([]string, 0, len(attempts))
+	for _, at := range attempts {
+		label := "修复"
+		if at.Number == 1 {
+			label = "首次执行"
+		}
+		outcome := "✅ 测试通过"
+		switch {
+		case at.ExitErr != nil:
+			outcome = "❌ agent 执行失败: " + at.ExitErr.Error()
+		case at.TestErr != nil:
+			outcome = "❌ 测试失败: " + at.TestErr.Error()
+		case at.LintErr != nil:
+			outcome = "❌ Lint 失败: " + at.LintErr.Error()
+		}
+		lines = append(lines, fmt.Sprintf("#%d %s（%s）%s", at.Number, label, at.Duration.Round(time.Second), outcome))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func fileList(changes []codex.FileChange) string {
+	lines := make([]string, 0, len(changes))
+	for _, c := range changes {
+		lines = append(lines, c.Kind+" "+c.Path)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func usageLine(u codex.Usage) string {
+	if u == (codex.Usage{}) {
+		return ""
+	}
+	return fmt.Sprintf("Token: 输入 %d（缓存 %d）/ 输出 %d", u.InputTokens, u.CachedInputTokens, u.OutputTokens)
+}
+
+// TaskView is what /status and /list show about a task. Latest holds the
+// most recent Codex output lines while the task runs.
+type TaskView struct {
+	Task      model.Task
+	Status    model.TaskStatus
+	UpdatedAt time.Time
+	Latest    []string
+}
+
+var statusLabels = map[model.TaskStatus]string{
+	model.StatusQueued:      "⏳ 排队中",
+	model.StatusPreparing:   "📦 检查仓库并准备工作区",
+	model.StatusRunning:     "🤖 Codex 执行中",
+	model.StatusTesting:     "🧪 测试中",
+	model.StatusDiffing:     "📝 收集 diff",
+	model.StatusSucceeded:   "✅ 成功",
+	model.StatusFailed:      "❌ 失败",
+	model.StatusCancelled:   "🛑 已取消",
+	model.StatusInterrupted: "⚠️ 已中断",
+}
+
+func statusLabel(s model.TaskStatus) string {
+	if l, ok := statusLabels[s]; ok {
+		return l
+	}
+	return string(s)
+}
+
+func Status(v TaskView) string {
+	s := fmt.Sprintf("%s\ntask_id=%s\nrepo=%s branch=%s\n更新于 %s\n任务: %s",
+		statusLabel(v.Status), v.Task.ID, v.Task.Repo, blankAs(v.Task.Branch, "(default)"),
+		v.UpdatedAt.Format("01-02 15:04:05"), truncateRunes(v.Task.Instruction, 80))
+	if len(v.Latest) > 0 {
+		s += "\n\n[最新输出]\n" + strings.Join(v.Latest, "\n")
+	}
+	return s
+}
+
+func List(views []TaskView) string {
+	if len(views) == 0 {
+		return "暂无任务"
+	}
+	lines := []string{"[我的任务]"}
+	for _, v := range views {
+		lines = append(lines, fmt.Sprintf("%s %s repo=%s %s", v.Task.ID, statusLabel(v.Status), v.Task.Repo, truncateRunes(v.Task.Instruction, 30)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// FullDiff is the reply to /diff: the task's saved patch, capped at maxLines.
+func FullDiff(task model.Task, patch string, maxLines int) string {
+	if strings.TrimSpace(patch) == "" {
+		return fmt.Sprintf("📝 任务没有产生改动\ntask_id=%s", task.ID)
+	}
+	return fmt.Sprintf("📝 完整 Diff\ntask_id=%s\n\n%s", task.ID, truncateLines(patch, maxLines))
+}
+
+func Cancelled(task model.Task) string {
+	return fmt.Sprintf("🛑 任务已取消\ntask_id=%s", task.ID)
+}
+
+func Interrupted(v TaskView, worktree string, removed bool) string {
+	parts := []string{
+		fmt.Sprintf("⚠️ runner 重启，任务在「%s」阶段中断", statusLabel(v.Status)),
+		fmt.Sprintf("task_id=%s", v.Task.ID),
+		fmt.Sprintf("repo=%s branch=%s", v.Task.Repo, blankAs(v.Task.Branch, "(default)")),
+		"任务: " + truncateRunes(v.Task.Instruction, 80),
+	}
+	switch {
+	case worktree != "" && removed:
+		parts = append(parts, "工作区已清理")
+	case worktree != "":
+		parts = append(parts, "工作区已保留: "+worktree)
+	}
+	parts = append(parts, fmt.Sprintf("发送 /retry %s 重新执行", v.Task.ID))
+	return strings.Join(parts, "\n")
+}
+
+func truncateRunes(s string, max int) string {
+	r := []rune(strings.TrimSpace(s))
+	if len(r) <= max {
+		return string(r)
+	}
+	return string(r[:max]) + "…"
+}
+
 func truncateLines(s string, max int) string {
 	lines := strings.Split(strings.TrimSpace(s), "\n")
 	if len(lines) <= max {
@@ -47,6 +349,15 @@ func truncateLines(s string, max int) string {
 	return strings.Join(lines[:max], "\n") + "\n... (truncated)"
 }
 
+// lastLines keeps the end of s, where command failures are usually reported.
+func lastLines(s string, max int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) <= max {
+		return strings.TrimSpace(s)
+	}
+	return "... (truncated)\n" + strings.Join(lines[len(lines)-max:], "\n")
+}
+
 func blankAs(v, d string) string {
 	if strings.TrimSpace(v) == "" {
 		return d
@@ -1,8 +1,15 @@
 package report
 
 import (
+	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
+	"time"
+
+	"feishu-codex-runner/internal/codex"
+	"feishu-codex-runner/internal/gotest"
+	"feishu-codex-runner/internal/model"
 )
 
 func TestTruncateLines(t *testing.T) {
@@ -12,3 +19,80 @@ func TestTruncateLines(t *testing.T) {
 		t.Fatalf("expected truncated marker, got %s", out)
 	}
 }
+
+func TestFinalCard(t *testing.T) {
+	task := model.Task{ID: "t1", Repo: "aoi"}
+	card := FinalCard(task, codex.Result{Output: "done ``` x", TestErr: errors.New("exit status 1")}, " a.go | 2 +-", "")
+	b, err := json.Marshal(card)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(b)
+	for _, want := range []string{`"template":"red"`, `"collapsible_panel"`, `"action":"retry","task_id":"t1"`, `"action":"diff","task_id":"t1"`} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("card missing %s: %s", want, s)
+		}
+	}
+	if strings.Count(s, "```") != 6 {
+		t.Fatalf("agent output must not break code fences: %s", s)
+	}
+}
+
+func TestProgressCard(t *testing.T) {
+	task := model.Task{ID: "t1", Repo: "aoi"}
+	b, _ := json.Marshal(ProgressCard(task, Progress{Status: model.StatusTesting, Elapsed: 95 * time.Second, Latest: []string{"running go test"}, Repair: 1, MaxRepairs: 3}))
+	s := string(b)
+	for _, want := range []string{"🧪 测试中", "1m35s", "✔️ 🤖 Codex 执行中", "▶️ 🧪 测试中", "⬜ 📝 收集 diff", "running go test", "修复 1/3", `"action":"cancel"`} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("card missing %q: %s", want, s)
+		}
+	}
+	b, _ = json.Marshal(ProgressCard(task, Progress{Status: model.StatusQueued, Position: 2}))
+	if !strings.Contains(string(b), "（第 2 位）") {
+		t.Fatalf("queued card should show position: %s", b)
+	}
+	b, _ = json.Marshal(ProgressCard(task, Progress{Status: model.StatusCancelled, Elapsed: time.Second}))
+	if strings.Contains(string(b), `"action":"cancel"`) {
+		t.Fatalf("finished card must not offer cancel: %s", b)
+	}
+}
+
+func TestFinalPrefersAgentFinalMessage(t *testing.T) {
+	run := codex.Result{
+		Output:       `{"type":"thread.started"}`,
+		FinalMessage: "healthz returns 503 now",
+		Commands:     []codex.CommandRun{{Command: "go test ./...", ExitCode: 1}},
+		Usage:        codex.Usage{InputTokens: 10, OutputTokens: 2},
+	}
+	s := Final(model.Task{ID: "t1"}, run, "", "")
+	for _, want := range []string{"[Codex 最终回复]\nhealthz returns 503 now", "✗ go test ./... (exit 1)", "输出 2"} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("report missing %q:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "thread.started") {
+		t.Fatalf("raw event output should not be shown:\n%s", s)
+	}
+}
+
+func TestFinalShowsFailingTests(t *testing.T) {
+	run := codex.Result{
+		TestOutput: "--- FAIL: TestAdd (0.00s)\n    calc_test.go:8: want 4\nFAIL\n",
+		TestErr:    errors.New("exit status 1"),
+		Tests: &gotest.Report{Passed: 3, Failed: 1, Failures: []gotest.Failure{
+			{Package: "example.com/demo/calc", Test: "TestAdd", Log: []string{"calc_test.go:8: want 4"}},
+		}},
+	}
+	s := Final(model.Task{ID: "t1"}, run, "", "")
+	want := "[测试结果]\n3 passed, 1 failed: TestAdd (example.com/demo/calc)\n\nTestAdd (example.com/demo/calc)\n    calc_test.go:8: want 4"
+	if !strings.Contains(s, want) {
+		t.Fatalf("report missing failing test section:\n%s", s)
+	}
+	if strings.Contains(s, "[测试输出]") {
+		t.Fatalf("raw test output should give way to the parsed result:\n%s", s)
+	}
+	b, _ := json.Marshal(FinalCard(model.Task{ID: "t1"}, run, "", ""))
+	if !strings.Contains(string(b), "测试结果") {
+		t.Fatalf("card missing test result panel: %s", b)
+	}
+}
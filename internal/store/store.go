@@ -10,9 +10,19 @@ import (
 )
 
 type State struct {
-	Cursor       string           `json:"cursor"`
-	LastPollUnix int64            `json:"last_poll_unix"`
-	Processed    map[string]int64 `json:"processed"`
+	// LastPollUnix is when the last complete poll started; chats without a
+	// cursor of their own are read from then on.
+	LastPollUnix int64                 `json:"last_poll_unix"`
+	Chats        map[string]ChatCursor `json:"chats"`
+	Processed    map[string]int64      `json:"processed"`
+}
+
+// ChatCursor is where polling resumes in a chat: messages created from
+// StartUnix on, continuing at PageToken when the previous poll stopped
+// between pages. The page token is only valid for the same StartUnix.
+type ChatCursor struct {
+	StartUnix int64  `json:"start_unix"`
+	PageToken string `json:"page_token,omitempty"`
 }
 
 type JSONStore struct {
@@ -27,7 +37,7 @@ func NewJSONStore(path string) *JSONStore {
 func (s *JSONStore) Load() (State, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	state := State{Processed: map[string]int64{}}
+	state := State{Chats: map[string]ChatCursor{}, Processed: map[string]int64{}}
 	data, err := os.ReadFile(s.path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -41,6 +51,9 @@ func (s *JSONStore) Load() (State, error) {
 	if state.Processed == nil {
 		state.Processed = map[string]int64{}
 	}
+	if state.Chats == nil {
+		state.Chats = map[string]ChatCursor{}
+	}
 	return state, nil
 }
 
@@ -0,0 +1,368 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"feishu-codex-runner/internal/codex"
+	"feishu-codex-runner/internal/model"
+)
+
+// TaskRecord is the persisted history of a single task.
+type TaskRecord struct {
+	Task        model.Task       `json:"task"`
+	Status      model.TaskStatus `json:"status"`
+	Transitions []Transition     `json:"transitions"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	Worktree    string           `json:"worktree,omitempty"`
+	WorkBranch  string           `json:"work_branch,omitempty"`
+	Result      *ResultRecord    `json:"result,omitempty"`
+}
+
+// Transition records when a task entered a status.
+type Transition struct {
+	Status model.TaskStatus `json:"status"`
+	At     time.Time        `json:"at"`
+}
+
+// ResultRecord is the serializable form of codex.Result plus the diff stat.
+type ResultRecord struct {
+	Agent          string        `json:"agent,omitempty"`
+	AgentVersion   string        `json:"agent_version,omitempty"`
+	Output         string        `json:"output"`
+	LogPath        string        `json:"log_path"`
+	Duration       time.Duration `json:"duration"`
+	TimedOut       bool          `json:"timed_out"`
+	ExitErr        string        `json:"exit_err,omitempty"`
+	TestOutput     string        `json:"test_output"`
+	TestErr        string        `json:"test_err,omitempty"`
+	TestSummary    string        `json:"test_summary,omitempty"`
+	LintOutput     string        `json:"lint_output,omitempty"`
+	LintErr        string        `json:"lint_err,omitempty"`
+	DiffStat       string        `json:"diff_stat"`
+	Branch         string        `json:"branch,omitempty"`
+	Worktree       string        `json:"worktree,omitempty"`
+	CommitSHA      string        `json:"commit_sha,omitempty"`
+	PushBranch     string        `json:"push_branch,omitempty"`
+	CommitErr      string        `json:"commit_err,omitempty"`
+	PullRequestURL string        `json:"pull_request_url,omitempty"`
+	PullRequestErr string        `json:"pull_request_err,omitempty"`
+
+	FinalMessage string             `json:"final_message,omitempty"`
+	Commands     []codex.CommandRun `json:"commands,omitempty"`
+	FilesChanged []codex.FileChange `json:"files_changed,omitempty"`
+	Usage        *codex.Usage       `json:"usage,omitempty"`
+	Attempts     []AttemptRecord    `json:"attempts,omitempty"`
+}
+
+// AttemptRecord is the serializable form of codex.Attempt.
+type AttemptRecord struct {
+	Number   int           `json:"number"`
+	Duration time.Duration `json:"duration"`
+	ExitErr  string        `json:"exit_err,omitempty"`
+	TestErr  string        `json:"test_err,omitempty"`
+	LintErr  string        `json:"lint_err,omitempty"`
+}
+
+func NewResultRecord(run codex.Result, diffStat string) ResultRecord {
+	rec := ResultRecord{
+		Agent:          run.Agent,
+		AgentVersion:   run.AgentVersion,
+		Output:         run.Output,
+		LogPath:        run.LogPath,
+		Duration:       run.Duration,
+		TimedOut:       run.TimedOut,
+		ExitErr:        errString(run.ExitErr),
+		TestOutput:     run.TestOutput,
+		TestErr:        errString(run.TestErr),
+		LintOutput:     run.LintOutput,
+		LintErr:        errString(run.LintErr),
+		DiffStat:       diffStat,
+		Branch:         run.Branch,
+		Worktree:       run.Worktree,
+		CommitSHA:      run.CommitSHA,
+		PushBranch:     run.PushBranch,
+		CommitErr:      errString(run.CommitErr),
+		PullRequestURL: run.PullRequestURL,
+		PullRequestErr: errString(run.PullRequestErr),
+		FinalMessage:   run.FinalMessage,
+		Commands:       run.Commands,
+		FilesChanged:   run.FilesChanged,
+	}
+	if len(run.Attempts) > 1 {
+		for _, at := range run.Attempts {
+			rec.Attempts = append(rec.Attempts, AttemptRecord{Number: at.Number, Duration: at.Duration, ExitErr: errString(at.ExitErr), TestErr: errString(at.TestErr), LintErr: errString(at.LintErr)})
+		}
+	}
+	if run.Tests != nil {
+		rec.TestSummary = run.Tests.Summary()
+	}
+	if run.Usage != (codex.Usage{}) {
+		usage := run.Usage
+		rec.Usage = &usage
+	}
+	return rec
+}
+
+// TaskFilter selects records in Query. Zero fields match everything; Since
+// and Until bound CreatedAt.
+type TaskFilter struct {
+	MessageID   string
+	RequesterID string
+	Repo        string
+	Statuses    []model.TaskStatus
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+}
+
+// TaskStore keeps every task in an append-only JSON-lines file. Each line is a
+// full snapshot of one record; the latest line for an ID wins. The file is
+// rewritten once stale snapshots clearly outnumber live records.
+type TaskStore struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	records map[string]*TaskRecord
+	lines   int
+}
+
+func OpenTaskStore(path string) (*TaskStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	s := &TaskStore{path: path, records: map[string]*TaskRecord{}}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if s.needsCompaction() {
+		if err := s.compact(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.openForAppend(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *TaskStore) openForAppend() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open task store: %w", err)
+	}
+	s.file = f
+	return nil
+}
+
+func (s *TaskStore) needsCompaction() bool {
+	return s.lines > 2*len(s.records)+100
+}
+
+func (s *TaskStore) load() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read task store: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var rec TaskRecord
+		// A torn final line after a crash is skipped rather than fatal.
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil || rec.Task.ID == "" {
+			continue
+		}
+		s.records[rec.Task.ID] = &rec
+		s.lines++
+	}
+	return sc.Err()
+}
+
+func (s *TaskStore) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, rec := range s.records {
+		data, _ := json.Marshal(rec)
+		w.Write(data)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.lines = len(s.records)
+	return os.Rename(tmp, s.path)
+}
+
+func (s *TaskStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Create stores a newly accepted task in the queued status.
+func (s *TaskStore) Create(task model.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	rec := &TaskRecord{
+		Task:        task,
+		Status:      model.StatusQueued,
+		Transitions: []Transition{{Status: model.StatusQueued, At: now}},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.records[task.ID] = rec
+	return s.append(rec)
+}
+
+// SetStatus records a status transition. Terminal statuses are final, so
+// late updates for a finished task are ignored.
+func (s *TaskStore) SetStatus(id string, status model.TaskStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return fmt.Errorf("task %s not found", id)
+	}
+	if rec.Status.Terminal() || rec.Status == status {
+		return nil
+	}
+	now := time.Now()
+	rec.Status = status
+	rec.UpdatedAt = now
+	rec.Transitions = append(rec.Transitions, Transition{Status: status, At: now})
+	return s.append(rec)
+}
+
+// SetResult attaches the execution result to a task.
+func (s *TaskStore) SetResult(id string, result ResultRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return fmt.Errorf("task %s not found", id)
+	}
+	rec.Result = &result
+	rec.UpdatedAt = time.Now()
+	return s.append(rec)
+}
+
+// SetWorktree records where a task's worktree lives, so it can be found
+// again if the runner crashes mid-run.
+func (s *TaskStore) SetWorktree(id, path, branch string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return fmt.Errorf("task %s not found", id)
+	}
+	rec.Worktree, rec.WorkBranch = path, branch
+	rec.UpdatedAt = time.Now()
+	return s.append(rec)
+}
+
+func (s *TaskStore) Get(id string) (TaskRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return TaskRecord{}, false
+	}
+	return *rec, true
+}
+
+// Query returns matching records, newest first.
+func (s *TaskStore) Query(f TaskFilter) []TaskRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []TaskRecord
+	for _, rec := range s.records {
+		if f.match(rec) {
+			out = append(out, *rec)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out
+}
+
+func (f TaskFilter) match(rec *TaskRecord) bool {
+	if f.MessageID != "" && rec.Task.MessageID != f.MessageID {
+		return false
+	}
+	if f.RequesterID != "" && rec.Task.RequesterID != f.RequesterID {
+		return false
+	}
+	if f.Repo != "" && rec.Task.Repo != f.Repo {
+		return false
+	}
+	if !f.Since.IsZero() && rec.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !rec.CreatedAt.Before(f.Until) {
+		return false
+	}
+	if len(f.Statuses) == 0 {
+		return true
+	}
+	for _, st := range f.Statuses {
+		if rec.Status == st {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TaskStore) append(rec *TaskRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write task store: %w", err)
+	}
+	s.lines++
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	if !s.needsCompaction() {
+		return nil
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	if err := s.compact(); err != nil {
+		log.Printf("compact task store: %v", err)
+	}
+	return s.openForAppend()
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"feishu-codex-runner/internal/codex"
+	"feishu-codex-runner/internal/model"
+)
+
+func TestTaskStorePersistsAndQueries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.jsonl")
+	s, err := OpenTaskStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range []model.Task{
+		{ID: "t1", Repo: "aoi", RequesterID: "u1"},
+		{ID: "t2", Repo: "aoi", RequesterID: "u2", MessageID: "m2"},
+		{ID: "t3", Repo: "bff", RequesterID: "u1"},
+	} {
+		if err := s.Create(task); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_ = s.SetStatus("t1", model.StatusRunning)
+	_ = s.SetWorktree("t1", "/tmp/wt/aoi-t1", "codex/t1")
+	_ = s.SetStatus("t1", model.StatusFailed)
+	_ = s.SetResult("t1", NewResultRecord(codex.Result{Output: "out", ExitErr: errors.New("exit status 1"), PullRequestErr: errors.New("403 Forbidden")}, "1 file changed"))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of writing a snapshot.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString(`{"task":{"ID":"t9"`)
+	f.Close()
+
+	s, err = OpenTaskStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	rec, ok := s.Get("t1")
+	if !ok || rec.Status != model.StatusFailed || len(rec.Transitions) != 3 {
+		t.Fatalf("unexpected record after reopen: %+v", rec)
+	}
+	if rec.Worktree != "/tmp/wt/aoi-t1" || rec.WorkBranch != "codex/t1" {
+		t.Fatalf("worktree not persisted: %+v", rec)
+	}
+	if got := s.Query(TaskFilter{MessageID: "m2"}); len(got) != 1 || got[0].Task.ID != "t2" {
+		t.Fatalf("query by message: %+v", got)
+	}
+	if rec.Result == nil || rec.Result.ExitErr != "exit status 1" || rec.Result.PullRequestErr != "403 Forbidden" || rec.Result.DiffStat != "1 file changed" {
+		t.Fatalf("unexpected result: %+v", rec.Result)
+	}
+
+	byUser := s.Query(TaskFilter{RequesterID: "u1"})
+	if len(byUser) != 2 || byUser[0].Task.ID != "t3" {
+		t.Fatalf("query by requester: %+v", byUser)
+	}
+	if got := s.Query(TaskFilter{Repo: "aoi", Statuses: []model.TaskStatus{model.StatusQueued}}); len(got) != 1 || got[0].Task.ID != "t2" {
+		t.Fatalf("query by repo and status: %+v", got)
+	}
+	if got := s.Query(TaskFilter{Since: time.Now().Add(time.Hour)}); len(got) != 0 {
+		t.Fatalf("query by time range: %+v", got)
+	}
+}
+
+func TestTaskStoreCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.jsonl")
+	s, err := OpenTaskStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_ = s.Create(model.Task{ID: "t1"})
+	statuses := []model.TaskStatus{model.StatusRunning, model.StatusTesting}
+	for i := 0; i < 200; i++ {
+		_ = s.SetStatus("t1", statuses[i%2])
+	}
+	if s.lines > 2*len(s.records)+100 {
+		t.Fatalf("store was not compacted: %d lines", s.lines)
+	}
+	if rec, _ := s.Get("t1"); len(rec.Transitions) != 201 {
+		t.Fatalf("compaction lost history: %d transitions", len(rec.Transitions))
+	}
+}